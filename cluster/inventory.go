@@ -0,0 +1,322 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/panel"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// InventoryPath 默认的站群清单文件
+var InventoryPath = "./inventory.yaml"
+
+// DefaultSiteRoot 网站未指定根目录时使用的目录，即宝塔面板创建网站时的默认目录
+var DefaultSiteRoot = "/www/wwwroot"
+
+var (
+	ErrInvalidInventory = errors.New("invalid inventory")
+	ErrUndefinedPanel   = errors.New("undefined panel")
+	ErrMissingKey       = errors.New("missing panel api key")
+)
+
+// Inventory 站群清单，记录全部宝塔面板及各面板上的网站
+type Inventory struct {
+	Panels []*Panel `json:"panels" yaml:"panels"`
+}
+
+// Panel 一个宝塔面板
+type Panel struct {
+	Name   string          `json:"name" yaml:"name"`                       // 名称，同上传队列中的面板名称
+	URL    string          `json:"url" yaml:"url"`                         // 面板地址，如：https://1.2.3.4:8888
+	KeyEnv string          `json:"key_env" yaml:"key_env"`                 // 保存接口密钥的环境变量，密钥不写入清单
+	TLS    panel.TLSConfig `json:"tls" yaml:"tls,omitempty"`               // HTTPS 证书的校验方式，面板使用自签名证书时设置
+	Sites  []*Site         `json:"sites,omitempty" yaml:"sites,omitempty"` // 面板上的网站
+}
+
+// Site 面板上的一个网站
+type Site struct {
+	Domain string                `json:"domain" yaml:"domain"`                   // 主域名，同面板中的网站名
+	Root   string                `json:"root,omitempty" yaml:"root,omitempty"`   // 根目录，为空时为 DefaultSiteRoot/<Domain>
+	Tags   []string              `json:"tags,omitempty" yaml:"tags,omitempty"`   // 网站的主题，collect.Tag 的英文名或数字
+	Image  *collect.ImageProcess `json:"image,omitempty" yaml:"image,omitempty"` // 上传图片前的处理
+	topics []collect.Tag
+}
+
+// Load 读取站群清单，按扩展名解析 .json .yaml .yml，并检查内容
+func Load(name string) (*Inventory, error) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Inventory{}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		err = json.Unmarshal(raw, inv)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, inv)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidInventory, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err = inv.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return inv, nil
+}
+
+// Save 按扩展名写入站群清单
+func (inv *Inventory) Save(name string) error {
+	var raw []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		if raw, err = json.MarshalIndent(inv, "", "  "); err == nil {
+			raw = append(raw, '\n')
+		}
+	case ".yaml", ".yml":
+		raw, err = yaml.Marshal(inv)
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidInventory, name)
+	}
+	if err != nil {
+		return err
+	}
+	return collect.WriteFileAtomic(name, raw)
+}
+
+// Validate 检查清单：面板名称不能重复，面板地址与密钥环境变量不能为空；
+// 同一面板上的域名与根目录不能重复，标签必须能被 collect.ParseTag 识别。未指定根目录的网站补全为默认目录
+func (inv *Inventory) Validate() error {
+	names := make(map[string]bool)
+	for i, p := range inv.Panels {
+		if p == nil || p.Name == "" {
+			return fmt.Errorf("%w: panels[%d]: 缺少 name", ErrInvalidInventory, i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("%w: %s: 面板名称重复", ErrInvalidInventory, p.Name)
+		}
+		names[p.Name] = true
+		if p.URL == "" {
+			return fmt.Errorf("%w: %s: 缺少 url", ErrInvalidInventory, p.Name)
+		}
+		if p.KeyEnv == "" {
+			return fmt.Errorf("%w: %s: 缺少 key_env", ErrInvalidInventory, p.Name)
+		}
+		domains, roots := make(map[string]bool), make(map[string]bool)
+		for j, s := range p.Sites {
+			if s == nil || s.Domain == "" {
+				return fmt.Errorf("%w: %s: sites[%d]: 缺少 domain", ErrInvalidInventory, p.Name, j)
+			}
+			if s.Root == "" {
+				s.Root = path.Join(DefaultSiteRoot, s.Domain)
+			}
+			if !path.IsAbs(s.Root) {
+				return fmt.Errorf("%w: %s: %s: 根目录必须是绝对路径", ErrInvalidInventory, p.Name, s.Domain)
+			}
+			s.Root = path.Clean(s.Root)
+			if domains[s.Domain] || roots[s.Root] {
+				return fmt.Errorf("%w: %s: %s: 域名或根目录重复", ErrInvalidInventory, p.Name, s.Domain)
+			}
+			domains[s.Domain], roots[s.Root] = true, true
+			s.topics = s.topics[:0]
+			for _, name := range s.Tags {
+				t, err := collect.ParseTag(name)
+				if err != nil {
+					return fmt.Errorf("%w: %s: %s: %s: %v", ErrInvalidInventory, p.Name, s.Domain, name, err)
+				}
+				s.topics = append(s.topics, t)
+			}
+		}
+	}
+	return nil
+}
+
+// Panel 名称为 name 的面板
+func (inv *Inventory) Panel(name string) (*Panel, error) {
+	for _, p := range inv.Panels {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUndefinedPanel, name)
+}
+
+// Uploader 可作为 collect.UploaderFunc 传给 UploadQueue.Flush，按面板名称创建接口客户端
+func (inv *Inventory) Uploader(name string) (collect.Uploader, error) {
+	p, err := inv.Panel(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.Client()
+}
+
+// ApplyImageProcess 将各网站的图片处理注册到 collect.SetImageProcess
+func (inv *Inventory) ApplyImageProcess() error {
+	for _, p := range inv.Panels {
+		for _, s := range p.Sites {
+			if s.Image == nil {
+				continue
+			}
+			if err := collect.SetImageProcess(s.Root, *s.Image); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SitesByTag 主题包含 t 的全部网站，key 为面板名称
+func (inv *Inventory) SitesByTag(t collect.Tag) map[string][]*Site {
+	r := make(map[string][]*Site)
+	for _, p := range inv.Panels {
+		for _, s := range p.Sites {
+			if s.HasTopic(t) {
+				r[p.Name] = append(r[p.Name], s)
+			}
+		}
+	}
+	return r
+}
+
+// Client 面板的接口客户端，密钥从 KeyEnv 读取，为空时返回 ErrMissingKey
+func (p *Panel) Client() (*panel.Client, error) {
+	key := os.Getenv(p.KeyEnv)
+	if key == "" {
+		return nil, fmt.Errorf("%w: %s: 环境变量 %s 为空", ErrMissingKey, p.Name, p.KeyEnv)
+	}
+	client := panel.NewClient(p.URL, key)
+	var err error
+	if client.Client, err = p.TLS.HTTPClient(); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name, err)
+	}
+	return client, nil
+}
+
+// Site 域名为 domain 的网站
+func (p *Panel) Site(domain string) (*Site, bool) {
+	for _, s := range p.Sites {
+		if s.Domain == domain {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Topics 网站的主题，需先经过 Validate
+func (s *Site) Topics() []collect.Tag {
+	return s.topics
+}
+
+// HasTopic 网站的主题是否包含 t
+func (s *Site) HasTopic(t collect.Tag) bool {
+	for _, tt := range s.topics {
+		if tt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 检查面板的接口是否可以访问、密钥是否正确
+func (p *Panel) Check(ctx context.Context) (panel.SystemInfo, error) {
+	client, err := p.Client()
+	if err != nil {
+		return panel.SystemInfo{}, err
+	}
+	return client.SystemTotal(ctx)
+}
+
+// SiteState 面板中的网站与清单比对的结果
+type SiteState string
+
+const (
+	SiteListed   SiteState = "listed"   // 清单中有，根目录相同
+	SiteUnlisted SiteState = "unlisted" // 面板中有、清单中没有
+	SiteMoved    SiteState = "moved"    // 清单中有，根目录与面板中不同
+	SiteMissing  SiteState = "missing"  // 清单中有、面板中没有
+)
+
+// SiteStatus 一个网站的比对结果
+type SiteStatus struct {
+	Domain string
+	Root   string    // 面板中的根目录，SiteMissing 时为空
+	State  SiteState // 比对结果
+	Site   *Site     // 清单中的网站，SiteUnlisted 时为 nil
+}
+
+// Compare 获取面板中的网站并与清单比对，不修改清单
+// 先按面板返回的顺序列出面板中的网站，再列出面板中没有的清单中的网站
+func (p *Panel) Compare(ctx context.Context) ([]SiteStatus, error) {
+	client, err := p.Client()
+	if err != nil {
+		return nil, err
+	}
+	var reported []panel.SiteInfo
+	if reported, err = client.Sites(ctx); err != nil {
+		return nil, err
+	}
+	r := make([]SiteStatus, 0, len(reported))
+	seen := make(map[string]bool)
+	for _, info := range reported {
+		seen[info.Name] = true
+		st := SiteStatus{Domain: info.Name, Root: path.Clean(info.Path), State: SiteUnlisted}
+		if s, ok := p.Site(info.Name); ok {
+			st.Site, st.State = s, SiteListed
+			if s.Root != st.Root {
+				st.State = SiteMoved
+			}
+		}
+		r = append(r, st)
+	}
+	for _, s := range p.Sites {
+		if !seen[s.Domain] {
+			r = append(r, SiteStatus{Domain: s.Domain, State: SiteMissing, Site: s})
+		}
+	}
+	return r, nil
+}
+
+// SyncResult 清单与面板中的网站的差异
+type SyncResult struct {
+	Added   []*Site // 面板中有、清单中没有的网站，已加入清单
+	Moved   []*Site // 根目录与面板中不同的网站，已改为面板中的根目录
+	Missing []*Site // 清单中有、面板中没有的网站，保留在清单中
+}
+
+// Changed 清单是否有改动
+func (r SyncResult) Changed() bool {
+	return len(r.Added) > 0 || len(r.Moved) > 0
+}
+
+// Sync 获取面板中的网站，与清单中的网站比对：面板中新增的网站加入清单，根目录以面板为准；
+// 面板中已经没有的网站只记录在 Missing 中，不从清单删除，以免丢失主题与图片处理的配置
+func (p *Panel) Sync(ctx context.Context) (SyncResult, error) {
+	var res SyncResult
+	list, err := p.Compare(ctx)
+	if err != nil {
+		return res, err
+	}
+	for _, st := range list {
+		switch st.State {
+		case SiteUnlisted:
+			s := &Site{Domain: st.Domain, Root: st.Root}
+			p.Sites = append(p.Sites, s)
+			res.Added = append(res.Added, s)
+		case SiteMoved:
+			st.Site.Root = st.Root
+			res.Moved = append(res.Moved, st.Site)
+		case SiteMissing:
+			res.Missing = append(res.Missing, st.Site)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,145 @@
+package cluster_test
+
+import (
+	"context"
+	"errors"
+	"github.com/cgghui/bt_site_cluster_collect/cluster"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/panel/paneltest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeInventory(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoad(t *testing.T) {
+	p := writeInventory(t, "inventory.yaml", `panels:
+  - name: hk
+    url: https://1.2.3.4:8888
+    key_env: BT_KEY_HK
+    tls:
+      insecure: true
+    sites:
+      - domain: a.com
+        tags: [commerce, 3]
+      - domain: b.com
+        root: /www/wwwroot/b/
+        image:
+          strip_metadata: true
+`)
+	inv, err := cluster.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hk, err := inv.Panel("hk")
+	if err != nil || len(hk.Sites) != 2 || !hk.TLS.Insecure {
+		t.Fatalf("panel=%+v error:%v", hk, err)
+	}
+	a, _ := hk.Site("a.com")
+	if a.Root != "/www/wwwroot/a.com" || len(a.Topics()) != 2 {
+		t.Fatalf("site=%+v topics=%v", a, a.Topics())
+	}
+	commerce, _ := collect.ParseTag("commerce")
+	if got := inv.SitesByTag(commerce); len(got["hk"]) != 1 || got["hk"][0] != a {
+		t.Fatalf("SitesByTag=%v", got)
+	}
+	if b, _ := hk.Site("b.com"); b.Root != "/www/wwwroot/b" {
+		t.Fatalf("root=%s", b.Root)
+	}
+	if err = inv.ApplyImageProcess(); err != nil {
+		t.Fatal(err)
+	}
+	if proc, ok := collect.GetImageProcess("/www/wwwroot/b"); !ok || !proc.StripMetadata {
+		t.Fatalf("image process=%+v ok=%v", proc, ok)
+	}
+	if _, err = inv.Panel("us"); !errors.Is(err, cluster.ErrUndefinedPanel) {
+		t.Fatalf("error:%v", err)
+	}
+	if _, err = inv.Uploader("hk"); !errors.Is(err, cluster.ErrMissingKey) {
+		t.Fatalf("error:%v", err)
+	}
+
+	for name, content := range map[string]string{
+		"dup.json":     `{"panels":[{"name":"a","url":"u","key_env":"K"},{"name":"a","url":"u","key_env":"K"}]}`,
+		"nokey.json":   `{"panels":[{"name":"a","url":"u"}]}`,
+		"tag.json":     `{"panels":[{"name":"a","url":"u","key_env":"K","sites":[{"domain":"a.com","tags":["nope"]}]}]}`,
+		"root.json":    `{"panels":[{"name":"a","url":"u","key_env":"K","sites":[{"domain":"a.com","root":"/x"},{"domain":"b.com","root":"/x/"}]}]}`,
+		"relative.yml": "panels:\n  - {name: a, url: u, key_env: K, sites: [{domain: a.com, root: www/a}]}\n",
+		"panels.txt":   "",
+	} {
+		if _, err = cluster.Load(writeInventory(t, name, content)); !errors.Is(err, cluster.ErrInvalidInventory) {
+			t.Errorf("%s: error:%v", name, err)
+		}
+	}
+}
+
+func TestCheckSync(t *testing.T) {
+	srv := paneltest.NewServer(t, "secret")
+	srv.AddSite("a.com", "/www/wwwroot/a.com")
+	srv.AddSite("b.com", "/data/b.com")
+	srv.AddSite("c.com", "/www/wwwroot/c.com")
+	t.Setenv("BT_KEY_TEST", "secret")
+	p := writeInventory(t, "inventory.json", `{"panels":[{"name":"test","url":"`+srv.URL+`","key_env":"BT_KEY_TEST","sites":[
+		{"domain":"a.com","tags":["commerce"]},
+		{"domain":"b.com"},
+		{"domain":"gone.com"}
+	]}]}`)
+	inv, err := cluster.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if info, err := inv.Panels[0].Check(ctx); err != nil || info.Version == "" {
+		t.Fatalf("info=%+v error:%v", info, err)
+	}
+	list, err := inv.Panels[0].Compare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[string]cluster.SiteState)
+	for _, st := range list {
+		states[st.Domain] = st.State
+	}
+	if len(list) != 4 || states["a.com"] != cluster.SiteListed || states["b.com"] != cluster.SiteMoved ||
+		states["c.com"] != cluster.SiteUnlisted || states["gone.com"] != cluster.SiteMissing {
+		t.Fatalf("sites=%+v", list)
+	}
+	if len(inv.Panels[0].Sites) != 3 {
+		t.Fatal("Compare modified the inventory")
+	}
+	res, err := inv.Panels[0].Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Added) != 1 || res.Added[0].Domain != "c.com" ||
+		len(res.Moved) != 1 || res.Moved[0].Root != "/data/b.com" ||
+		len(res.Missing) != 1 || res.Missing[0].Domain != "gone.com" || !res.Changed() {
+		t.Fatalf("sync=%+v", res)
+	}
+	if err = inv.Save(p); err != nil {
+		t.Fatal(err)
+	}
+	if inv, err = cluster.Load(p); err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Panels[0].Sites) != 4 || strings.Join(inv.Panels[0].Sites[0].Tags, ",") != "commerce" {
+		t.Fatalf("sites=%+v", inv.Panels[0].Sites)
+	}
+	if res, err = inv.Panels[0].Sync(ctx); err != nil || res.Changed() {
+		t.Fatalf("sync=%+v error:%v", res, err)
+	}
+
+	t.Setenv("BT_KEY_TEST", "wrong")
+	if _, err = inv.Panels[0].Check(ctx); err == nil {
+		t.Fatal("expected error with wrong key")
+	}
+}
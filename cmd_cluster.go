@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/cgghui/bt_site_cluster_collect/cluster"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runCluster 管理站群清单：check 检查各面板的接口，sites 列出各面板报告的网站并与清单比对，sync 将面板中的网站同步到清单
+func runCluster(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("cluster "+action, flag.ContinueOnError)
+	inventoryPath := fs.String("inventory", cluster.InventoryPath, "站群清单文件，.json .yaml .yml")
+	panelName := fs.String("panel", "", "只处理该面板，为空时为全部面板")
+	timeout := fs.Duration("timeout", 30*time.Second, "每个面板的期限，0 为不限")
+	write := fs.Bool("write", false, "sync：将结果写回清单文件")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	inv, err := cluster.Load(*inventoryPath)
+	if err != nil {
+		return err
+	}
+	panels := inv.Panels
+	if *panelName != "" {
+		p, err := inv.Panel(*panelName)
+		if err != nil {
+			return err
+		}
+		panels = []*cluster.Panel{p}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	failed := 0
+	switch action {
+	case "check":
+		for _, p := range panels {
+			pCtx, cancel := withTimeout(ctx, *timeout)
+			info, err := p.Check(pCtx)
+			cancel()
+			if err != nil {
+				failed++
+				fmt.Fprintf(w, "%s\t%s\terror\t%v\n", p.Name, p.URL, err)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\tok\t%s %s\n", p.Name, p.URL, info.Version, info.System)
+		}
+	case "sites":
+		// 状态为 listed、unlisted（清单中没有）、moved（根目录与清单不同）、missing（面板中没有）
+		for _, p := range panels {
+			pCtx, cancel := withTimeout(ctx, *timeout)
+			list, err := p.Compare(pCtx)
+			cancel()
+			if err != nil {
+				failed++
+				fmt.Fprintf(w, "%s\terror\t%v\t\t\n", p.Name, err)
+				continue
+			}
+			for _, st := range list {
+				root, tags := st.Root, ""
+				if st.Site != nil {
+					tags = strings.Join(st.Site.Tags, ",")
+					switch st.State {
+					case cluster.SiteMoved:
+						root += " (inventory: " + st.Site.Root + ")"
+					case cluster.SiteMissing:
+						root = st.Site.Root
+					}
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Name, st.State, st.Domain, root, tags)
+			}
+		}
+	case "sync":
+		changed := false
+		for _, p := range panels {
+			pCtx, cancel := withTimeout(ctx, *timeout)
+			res, err := p.Sync(pCtx)
+			cancel()
+			if err != nil {
+				failed++
+				fmt.Fprintf(w, "%s\terror\t%v\t\n", p.Name, err)
+				continue
+			}
+			for _, s := range res.Added {
+				fmt.Fprintf(w, "%s\tadded\t%s\t%s\n", p.Name, s.Domain, s.Root)
+			}
+			for _, s := range res.Moved {
+				fmt.Fprintf(w, "%s\tmoved\t%s\t%s\n", p.Name, s.Domain, s.Root)
+			}
+			for _, s := range res.Missing {
+				fmt.Fprintf(w, "%s\tmissing\t%s\t%s\n", p.Name, s.Domain, s.Root)
+			}
+			changed = changed || res.Changed()
+		}
+		if changed && *write {
+			if err = inv.Save(*inventoryPath); err != nil {
+				return err
+			}
+			log.Printf("saved %s", *inventoryPath)
+		}
+	default:
+		return ErrUsage
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d panels failed", failed, len(panels))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"log"
+	"os"
+	"strings"
+)
+
+// runCrawlAll 并发采集多个站点的全部标签，结果按完成顺序输出
+func runCrawlAll(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("crawl-all", flag.ContinueOnError)
+	sites := fs.String("sites", "", "采集器名称，以逗号分隔，为空时采集全部站点")
+	pages := fs.Int("pages", 1, "每个标签采集的页数")
+	detail := fs.Bool("detail", true, "是否采集文章详情")
+	timeout := fs.Duration("timeout", 0, "整个采集任务的期限，0 为不限")
+	concurrency := fs.Int("concurrency", 8, "全部站点合计的最大并发数")
+	siteConcurrency := fs.Int("site-concurrency", 2, "每个站点的最大并发数")
+	thumbnailFlag(fs)
+	hashImagesFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *pages < 1 {
+		return ErrUsage
+	}
+	jobs := collect.AllJobs(*pages)
+	if *sites != "" {
+		jobs = jobs[:0]
+		for _, site := range strings.Split(*sites, ",") {
+			site = strings.TrimSpace(site)
+			std, err := getStandard(site)
+			if err != nil {
+				return err
+			}
+			for _, tag := range sortedTags(std) {
+				jobs = append(jobs, collect.CrawlJob{Site: site, Tag: tag, Pages: *pages})
+			}
+		}
+	}
+	ctx, cancel := withTimeout(ctx, *timeout)
+	defer cancel()
+	s := &collect.Scheduler{Concurrency: *concurrency, SiteConcurrency: *siteConcurrency, Detail: *detail}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	var total, failed int
+	var encErr error
+	for r := range s.Run(ctx, jobs) {
+		if encErr != nil {
+			continue
+		}
+		if r.Err != nil {
+			failed++
+			if r.Article == nil {
+				log.Printf("%s %s page %d: %v", r.Site, r.Tag, r.Page, r.Err)
+			} else {
+				log.Printf("%s %s: %v", r.Site, r.Article.Href, r.Err)
+			}
+			continue
+		}
+		total++
+		if encErr = enc.Encode(r.Article); encErr != nil {
+			// 停止采集，读完剩余的结果
+			cancel()
+		}
+	}
+	if encErr != nil {
+		return encErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		log.Printf("%d articles, %d errors", total, failed)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/export"
+	"io"
+	"os"
+)
+
+// runExport 从标准输入读取 crawl 输出的 JSON Lines 并导出
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "jsonl", "导出格式：wxr、jsonl、markdown")
+	in := fs.String("in", "-", "输入文件，- 为标准输入")
+	out := fs.String("out", "-", "输出文件，markdown 格式时为目录，- 为标准输出")
+	jekyll := fs.Bool("jekyll", false, "markdown 格式使用 Jekyll 的文件名")
+	opt := export.Options{}
+	fs.StringVar(&opt.Title, "title", "", "站点名称，用于 wxr")
+	fs.StringVar(&opt.Link, "link", "", "站点地址，用于 wxr")
+	fs.StringVar(&opt.ImageBaseURL, "image-base-url", "", "图片地址改写为以此开头")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if *out != "-" && *format != "markdown" {
+		fp, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = fp.Close()
+		}()
+		w = fp
+	}
+	bw := bufio.NewWriter(w)
+	var exp export.Exporter
+	switch *format {
+	case "wxr":
+		exp = export.NewWXR(bw, opt)
+	case "jsonl":
+		exp = export.NewJSONL(bw, opt)
+	case "markdown":
+		if *out == "-" {
+			return ErrUsage
+		}
+		var err error
+		if exp, err = export.NewMarkdown(*out, *jekyll, opt); err != nil {
+			return err
+		}
+	default:
+		return ErrUsage
+	}
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		fp, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = fp.Close()
+		}()
+		r = fp
+	}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var art collect.Article
+		if err := dec.Decode(&art); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := exp.Write(&art); err != nil {
+			return err
+		}
+	}
+	if err := exp.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
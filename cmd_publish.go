@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/publish"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// headerFlag 可重复的 "Name: Value" 请求头参数
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	return fmt.Sprint(http.Header(h))
+}
+
+func (h headerFlag) Set(s string) error {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) != 2 {
+		return ErrUsage
+	}
+	http.Header(h).Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	return nil
+}
+
+// runPublish 从标准输入读取 crawl 输出的 JSON Lines 并发布
+func runPublish(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ContinueOnError)
+	site := fs.String("site", "", "采集器名称")
+	in := fs.String("in", "-", "输入文件，- 为标准输入")
+	dir := fs.String("dir", "", "发布到本地目录")
+	httpURL := fs.String("http-url", "", "以 JSON 形式 POST 到该地址")
+	header := headerFlag(make(http.Header))
+	fs.Var(header, "http-header", "附加的请求头，Name: Value，可重复")
+	wpURL := fs.String("wp-url", "", "WordPress 站点地址")
+	wpUser := fs.String("wp-user", "", "WordPress 用户名")
+	wpPasswordEnv := fs.String("wp-password-env", "WP_APP_PASSWORD", "保存 WordPress 应用密码的环境变量")
+	wpStatus := fs.String("wp-status", "publish", "WordPress 文章状态")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *site == "" {
+		return ErrUsage
+	}
+	var publishers publish.Multi
+	if *dir != "" {
+		publishers = append(publishers, publish.Dir{Root: *dir})
+	}
+	if *httpURL != "" {
+		publishers = append(publishers, publish.HTTP{URL: *httpURL, Header: http.Header(header)})
+	}
+	if *wpURL != "" {
+		publishers = append(publishers, &publish.WordPress{
+			BaseURL:  *wpURL,
+			Username: *wpUser,
+			Password: os.Getenv(*wpPasswordEnv),
+			Status:   *wpStatus,
+		})
+	}
+	if len(publishers) == 0 {
+		return ErrUsage
+	}
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		fp, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = fp.Close()
+		}()
+		r = fp
+	}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var art collect.Article
+		if err := dec.Decode(&art); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := publishers.Publish(ctx, *site, &art); err != nil {
+			return fmt.Errorf("%s: %w", art.Href, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/sitegen"
+	"io"
+	"log"
+	"os"
+)
+
+// runSite 将 crawl 输出的文章生成静态站点，指定 --site-root 时上传到宝塔面板的站点
+func runSite(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("site", flag.ContinueOnError)
+	in := fs.String("in", "-", "crawl 输出的 JSON Lines 文件，- 为标准输入")
+	out := fs.String("out", "./site", "输出目录")
+	themeDir := fs.String("theme", "", "主题目录，为空时使用内置主题")
+	title := fs.String("title", "", "站点名称")
+	siteURL := fs.String("url", "", "站点地址，如：https://www.example.com，为空时不生成站点地图、RSS 与 Atom")
+	description := fs.String("description", "", "站点描述")
+	pageSize := fs.Int("page-size", sitegen.DefaultPageSize, "列表页每页的文章数")
+	siteRoot := fs.String("site-root", "", "上传到的站点根目录，如：/www/wwwroot/example.com，为空时只生成")
+	manifest := fs.String("manifest", "", "已上传文件的记录，为空时保存在输出目录的 .deploy 中")
+	panelURL := fs.String("panel-url", "", "面板地址，如：https://1.2.3.4:8888")
+	panelKeyEnv := fs.String("panel-key-env", "BT_API_KEY", "保存面板接口密钥的环境变量")
+	panelTLS := panelTLSFlags(fs)
+	imageConfig := fs.String("image-config", "", "各站点上传前去掉元数据、加水印的配置文件，.json .yaml .yml")
+	timeout := fs.Duration("timeout", 0, "整个任务的期限，0 为不限")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *siteRoot != "" && *panelURL == "" {
+		return ErrUsage
+	}
+	gen := &sitegen.Generator{
+		Site:     sitegen.Site{Title: *title, URL: *siteURL, Description: *description},
+		Dir:      *out,
+		PageSize: *pageSize,
+	}
+	if *themeDir != "" {
+		theme, err := sitegen.LoadTheme(os.DirFS(*themeDir))
+		if err != nil {
+			return err
+		}
+		gen.Theme = theme
+	}
+	arts, err := readArticles(*in)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, *timeout)
+	defer cancel()
+	built, err := gen.Build(ctx, arts)
+	if err != nil {
+		return err
+	}
+	log.Printf("%d articles, %d files written, %d unchanged", len(arts), len(built.Written), built.Unchanged)
+	if *siteRoot == "" {
+		return nil
+	}
+	if *imageConfig != "" {
+		if err = collect.LoadImageProcess(*imageConfig); err != nil {
+			return err
+		}
+	}
+	images := make([]string, 0)
+	for _, art := range arts {
+		images = append(images, art.LocalImages...)
+	}
+	client, err := newPanelClient(*panelURL, *panelKeyEnv, panelTLS)
+	if err != nil {
+		return err
+	}
+	deployer := sitegen.Deployer{Dir: *out, SiteRoot: *siteRoot, Manifest: *manifest}
+	res, err := deployer.Deploy(ctx, client, images)
+	log.Printf("uploaded %d, skipped %d", res.Uploaded, res.Skipped)
+	return err
+}
+
+// readArticles 读取 crawl 输出的 JSON Lines，in 为 - 时读取标准输入
+func readArticles(in string) ([]*collect.Article, error) {
+	var r io.Reader = os.Stdin
+	if in != "-" {
+		fp, err := os.Open(in)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = fp.Close()
+		}()
+		r = fp
+	}
+	arts := make([]*collect.Article, 0)
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		art := &collect.Article{}
+		if err := dec.Decode(art); err == io.EOF {
+			return arts, nil
+		} else if err != nil {
+			return nil, err
+		}
+		arts = append(arts, art)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/cgghui/bt_site_cluster_collect/cluster"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+// runUploadQueue 管理图片上传队列：add 加入文章中的图片，list 查看，flush 上传，requeue 重试失败的，compact 整理文件
+func runUploadQueue(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("upload-queue "+action, flag.ContinueOnError)
+	queuePath := fs.String("queue", collect.UploadQueuePath, "上传队列文件")
+	panelName := fs.String("panel", "", "面板名称")
+	siteRoot := fs.String("site-root", "", "add：站点在服务器上的根目录，如：/www/wwwroot/example.com")
+	in := fs.String("in", "-", "add：crawl 输出的 JSON Lines 文件，- 为标准输入")
+	status := fs.String("status", "", "list：只列出该状态，pending、uploaded 或 failed")
+	panelURL := fs.String("panel-url", "", "flush：面板地址，如：https://1.2.3.4:8888")
+	panelKeyEnv := fs.String("panel-key-env", "BT_API_KEY", "flush：保存面板接口密钥的环境变量")
+	panelTLS := panelTLSFlags(fs)
+	force := fs.Bool("force", false, "flush：忽略重试的等待时间")
+	timeout := fs.Duration("timeout", 0, "flush：整个上传任务的期限，0 为不限")
+	imageConfig := fs.String("image-config", "", "flush：各站点上传前去掉元数据、加水印的配置文件，.json .yaml .yml")
+	inventoryPath := fs.String("inventory", "", "flush：站群清单文件，指定时按面板名称取面板地址、密钥与图片处理，可不指定 --panel")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	queue, err := collect.OpenUploadQueue(*queuePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = queue.Close()
+	}()
+	switch action {
+	case "add":
+		if *panelName == "" || *siteRoot == "" {
+			return ErrUsage
+		}
+		return enqueueImages(queue, *panelName, *siteRoot, *in)
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, e := range queue.Entries() {
+			if (*status != "" && string(e.Status) != *status) || (*panelName != "" && e.Panel != *panelName) {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", e.Status, e.Panel, e.SiteRoot, e.Path, e.Attempts, e.Error)
+		}
+		return w.Flush()
+	case "flush":
+		var get collect.UploaderFunc
+		if *inventoryPath != "" {
+			inv, err := cluster.Load(*inventoryPath)
+			if err != nil {
+				return err
+			}
+			if err = inv.ApplyImageProcess(); err != nil {
+				return err
+			}
+			get = inv.Uploader
+		} else {
+			if *panelName == "" || *panelURL == "" {
+				return ErrUsage
+			}
+			client, err := newPanelClient(*panelURL, *panelKeyEnv, panelTLS)
+			if err != nil {
+				return err
+			}
+			get = func(string) (collect.Uploader, error) {
+				return client, nil
+			}
+		}
+		if *imageConfig != "" {
+			if err = collect.LoadImageProcess(*imageConfig); err != nil {
+				return err
+			}
+		}
+		ctx, cancel := withTimeout(ctx, *timeout)
+		defer cancel()
+		res, err := queue.Flush(ctx, *panelName, *force, get)
+		log.Printf("uploaded %d, retrying %d, failed %d", res.Uploaded, res.Retrying, res.Failed)
+		return err
+	case "requeue":
+		n, err := queue.Requeue(*panelName)
+		log.Printf("requeued %d", n)
+		return err
+	case "compact":
+		return queue.Compact()
+	}
+	return ErrUsage
+}
+
+// enqueueImages 将 in 中每篇文章的 LocalImages 加入队列
+func enqueueImages(queue *collect.UploadQueue, panelName, siteRoot, in string) error {
+	var r io.Reader = os.Stdin
+	if in != "-" {
+		fp, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = fp.Close()
+		}()
+		r = fp
+	}
+	added := 0
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var art collect.Article
+		if err := dec.Decode(&art); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		for _, p := range art.LocalImages {
+			ok, err := queue.Enqueue(panelName, siteRoot, p)
+			if err != nil {
+				return err
+			}
+			if ok {
+				added++
+			}
+		}
+	}
+	log.Printf("queued %d images", added)
+	return nil
+}
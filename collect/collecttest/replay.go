@@ -0,0 +1,153 @@
+// Package collecttest 采集器的离线测试工具：按链接回放 testdata 中保存的响应，并以 golden 文件校验采集结果
+package collecttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "用当前的采集结果更新 golden 文件")
+
+// Transport 按请求链接回放本地文件，未登记的链接返回 404
+type Transport struct {
+	routes map[string]string
+}
+
+// NewTransport routes 为 完整链接 -> 文件路径
+func NewTransport(routes map[string]string) *Transport {
+	t := &Transport{routes: make(map[string]string, len(routes))}
+	for link, file := range routes {
+		t.routes[normalize(link)] = file
+	}
+	return t
+}
+
+func normalize(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return u.String()
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	file, ok := t.routes[req.URL.String()]
+	if !ok {
+		resp.StatusCode = http.StatusNotFound
+		resp.Status = "404 Not Found"
+		resp.Body = io.NopCloser(bytes.NewReader(nil))
+		return resp, nil
+	}
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	resp.StatusCode = http.StatusOK
+	resp.Status = "200 OK"
+	resp.ContentLength = int64(len(body))
+	if ct := mime.TypeByExtension(filepath.Ext(file)); ct != "" {
+		resp.Header.Set("Content-Type", ct)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// Install 让 collect 的全部网络请求走回放，图片保存到临时目录，快照存于内存
+// 测试结束后自动还原
+func Install(t testing.TB, routes map[string]string) {
+	t.Helper()
+	transport := NewTransport(routes)
+	httpClient, downloadClient := collect.HttpClient, collect.DownloadClient
+	imgRootPath, snapshot := collect.ImgRootPath, collect.Snapshot
+	hc := *collect.HttpClient
+	hc.Transport = transport
+	collect.HttpClient = &hc
+	collect.DownloadClient = &http.Client{Transport: transport}
+	collect.ImgRootPath = t.TempDir()
+	collect.Snapshot = collect.NewMemorySnapshotStore()
+	t.Cleanup(func() {
+		collect.HttpClient, collect.DownloadClient = httpClient, downloadClient
+		collect.ImgRootPath, collect.Snapshot = imgRootPath, snapshot
+	})
+}
+
+// Live 访问真实站点的测试，仅在设置了环境变量 COLLECT_LIVE 时运行
+func Live(t testing.TB) {
+	t.Helper()
+	if os.Getenv("COLLECT_LIVE") == "" {
+		t.Skip("set COLLECT_LIVE=1 to run tests against live sites")
+	}
+}
+
+// GoldenArticle golden 文件中记录的文章字段
+type GoldenArticle struct {
+	Href        string
+	Title       string
+	PostTime    string
+	Tag         []collect.ArticleTag
+	LocalImages []string
+	Images      []collect.ImageRecord `json:",omitempty"`
+	Cover       string                `json:",omitempty"`
+	Content     string
+}
+
+// AssertGolden 将 arts 与 golden 文件比较，go test -update 时改为写入
+func AssertGolden(t testing.TB, golden string, arts []collect.Article) {
+	t.Helper()
+	got := make([]GoldenArticle, 0, len(arts))
+	for _, art := range arts {
+		ga := GoldenArticle{
+			Href:        art.Href,
+			Title:       art.Title,
+			Tag:         art.Tag,
+			LocalImages: art.LocalImages,
+			Images:      art.Images,
+			Cover:       art.Cover,
+			Content:     art.Content,
+		}
+		if !art.PostTime.IsZero() {
+			ga.PostTime = art.PostTime.UTC().Format(time.RFC3339)
+		}
+		got = append(got, ga)
+	}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(got); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("error:%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(want, buf.Bytes()) {
+		t.Errorf("%s mismatch\n--- want\n%s\n--- got\n%s", golden, want, buf.Bytes())
+	}
+}
@@ -0,0 +1,65 @@
+package collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration JSON 中的时长，可以是 time.ParseDuration 能解析的字符串，如："500ms"，也可以是纳秒数
+// 使站点定义的 JSON 与 YAML 写法一致
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value)
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration: %s", raw)
+	}
+	return nil
+}
+
+// UnmarshalJSON 时长字段使用 Duration 解析
+func (l *RateLimit) UnmarshalJSON(raw []byte) error {
+	type plain RateLimit
+	v := struct {
+		*plain
+		MinDelay   Duration `json:"min_delay"`
+		MaxBackoff Duration `json:"max_backoff"`
+	}{plain: (*plain)(l), MinDelay: Duration(l.MinDelay), MaxBackoff: Duration(l.MaxBackoff)}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	l.MinDelay, l.MaxBackoff = time.Duration(v.MinDelay), time.Duration(v.MaxBackoff)
+	return nil
+}
+
+// UnmarshalJSON 时长字段使用 Duration 解析
+func (p *RetryPolicy) UnmarshalJSON(raw []byte) error {
+	type plain RetryPolicy
+	v := struct {
+		*plain
+		BaseDelay Duration `json:"base_delay"`
+		MaxDelay  Duration `json:"max_delay"`
+	}{plain: (*plain)(p), BaseDelay: Duration(p.BaseDelay), MaxDelay: Duration(p.MaxDelay)}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	p.BaseDelay, p.MaxDelay = time.Duration(v.BaseDelay), time.Duration(v.MaxDelay)
+	return nil
+}
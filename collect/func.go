@@ -1,15 +1,18 @@
 package collect
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/cgghui/bt_site_cluster/bt"
-	"github.com/cgghui/cgghui"
 	"io"
-	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -19,118 +22,264 @@ var ErrNotScheme = errors.New("not scheme")
 var ErrUndefinedSite = errors.New("undefined site")
 var ErrInvalidImage = errors.New("invalid image")
 
-const ImgRootPath = "./upload_temp"
+// ImgRootPath 图片的本地保存目录
+var ImgRootPath = "./upload_temp"
+
 const UploadTimeout = 10 * time.Minute
 
+// DownloadClient 下载图片使用的客户端，与 HttpClient 不同，允许跟随跳转
+var DownloadClient = &http.Client{Transport: Limiter}
+
 // DownloadImage 下载图片
 func DownloadImage(imgURL string) (string, error) {
-	imgURL = strings.Trim(imgURL, " ")
-	if strings.HasPrefix(imgURL, "//") {
-		imgURL = "http:" + imgURL
-	}
-	var err error
-	var link *url.URL
-	if link, err = url.Parse(imgURL); err != nil {
+	return DownloadImageContext(context.Background(), imgURL)
+}
+
+// DownloadImageContext 下载图片，ctx 取消或超时后中断下载
+// 下载地址由 ImageRule 决定；ImageContentAddressed 为 true 时按内容保存，见 downloadHashed，
+// 否则按 ImageRule 给出的路径保存，扩展名与图片的实际格式不符时改为实际格式的扩展名，
+// 返回相对 ImgRootPath 的保存路径
+func DownloadImageContext(ctx context.Context, imgURL string) (string, error) {
+	target, err := ResolveImage(imgURL)
+	if err != nil {
 		return "", err
 	}
-	if !strings.Contains(link.Scheme, "http") {
-		return "", ErrNotScheme
+	if ImageContentAddressed {
+		return downloadHashed(ctx, target.URL)
 	}
-	//
-	storePath := ImgRootPath + link.Path
-	//
-	if strings.Contains(link.Host, ".aliyuncs.com") {
-		if strings.Contains(imgURL, "?x-oss-process") {
-			imgURL = strings.SplitN(imgURL, "?x-oss-process", 2)[0]
-		}
+	storePath := ImgRootPath + target.StorePath()
+	if p, ok := existingImage(storePath); ok {
+		return strings.TrimPrefix(p, ImgRootPath), nil
 	}
-	if link.Host == "upload-images.jianshu.io" {
-		if strings.Contains(imgURL, "?imageMogr2") {
-			imgURL = strings.SplitN(imgURL, "?imageMogr2", 2)[0]
-		}
+	err = Retry.Do(ctx, func(ctx context.Context) error {
+		var e error
+		storePath, e = download(ctx, target.URL, ImgRootPath+target.StorePath(), true)
+		return e
+	})
+	if err != nil {
+		return "", err
 	}
-	if strings.Contains(link.Host, ".toutiaoimg.com") {
-		storePath = strings.SplitN(storePath, "~", 2)[0] + ".jpg"
+	return strings.TrimPrefix(storePath, ImgRootPath), nil
+}
+
+// downloadHashed 下载图片并以内容的 SHA-256 命名，记录到 GetImageIndex
+// 已下载过的地址直接返回；不同地址的相同图片只保存一份
+func downloadHashed(ctx context.Context, imgURL string) (string, error) {
+	index, err := GetImageIndex()
+	if err != nil {
+		return "", err
 	}
-	if strings.Contains(link.Host, ".toutiao.com") {
-		if link.Path == "/mp/agw/article_material/open_image/get" {
-			return "", ErrInvalidImage
-		}
+	if e, ok := index.Lookup(imgURL); ok && PathExists(ImgRootPath+e.Path) {
+		return e.Path, nil
 	}
-	if strings.Contains(link.Host, ".byteimg.com") {
-		storePath = strings.ReplaceAll(storePath, "~", "_") + ".jpg"
-		storePath = strings.ReplaceAll(storePath, ":", "_")
+	dir := ImgRootPath + ImageHashDir
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", err
 	}
-	if strings.Contains(link.Host, ".ws.126.net") {
-		q := link.Query()
-		if q.Has("type") {
-			storePath = ImgRootPath + "/ws126net/" + cgghui.MD5(imgURL) + "." + q.Get("type")
+	var tmp, ext, sum string
+	err = Retry.Do(ctx, func(ctx context.Context) error {
+		var e error
+		tmp, ext, sum, e = fetchImage(ctx, imgURL, dir)
+		return e
+	})
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.Remove(tmp)
+	}()
+	storePath := HashImagePath(sum, ext)
+	if !PathExists(ImgRootPath + storePath) {
+		if err = os.MkdirAll(path.Dir(ImgRootPath+storePath), 0755); err != nil {
+			return "", err
+		}
+		if err = os.Rename(tmp, ImgRootPath+storePath); err != nil {
+			return "", err
 		}
 	}
-	if strings.Contains(link.Host, "inews.gtimg.com") {
-		storePath = ImgRootPath + "/inews_gtimg_com/" + cgghui.MD5(imgURL) + ".jpg"
+	if err = index.Put(ImageIndexEntry{URL: imgURL, Path: storePath, SHA256: sum}); err != nil {
+		return "", err
 	}
-	if strings.Contains(link.Host, ".qpic.cn") {
-		q := link.Query()
-		if q.Has("wx_fmt") {
-			storePath = ImgRootPath + "/qpic_cn/" + cgghui.MD5(imgURL) + "." + q.Get("wx_fmt")
-		} else {
-			storePath = ImgRootPath + "/qpic_cn/" + cgghui.MD5(imgURL) + ".jpg"
+	return storePath, nil
+}
+
+// existingImage 已下载的图片，包括保存时改过扩展名的
+func existingImage(storePath string) (string, bool) {
+	if PathExists(storePath) {
+		return storePath, true
+	}
+	for _, ext := range imageExts {
+		if p := FixImageExt(storePath, ext); p != storePath && PathExists(p) {
+			return p, true
 		}
 	}
-	if strings.Contains(link.Host, ".meipian.me") {
-		storePath = strings.SplitN(storePath, "-mobile", 2)[0]
+	return "", false
+}
+
+func Download(target, storePath string) error {
+	return DownloadContext(context.Background(), target, storePath)
+}
+
+// DownloadContext 下载图片 target 并保存到 storePath，ctx 取消或超时后中断下载
+// 非 2xx 的响应、无法识别的图片格式、小于 ImageMinSize 或大于 ImageMaxSize 的图片都会返回错误，
+// 失败时不会留下文件
+func DownloadContext(ctx context.Context, target, storePath string) error {
+	return Retry.Do(ctx, func(ctx context.Context) error {
+		_, err := download(ctx, target, storePath, false)
+		return err
+	})
+}
+
+// download 下载并校验图片，校验通过后保存为 storePath
+// fixExt 为 true 时按图片格式修正 storePath 的扩展名，返回实际的保存路径
+func download(ctx context.Context, target, storePath string, fixExt bool) (string, error) {
+	if err := os.MkdirAll(path.Dir(storePath), 0755); err != nil {
+		return "", err
 	}
-	if storePath == ImgRootPath+"/" {
-		return "", ErrNotFile
+	tmp, ext, _, err := fetchImage(ctx, target, path.Dir(storePath))
+	if err != nil {
+		return "", err
 	}
-	if PathExists(storePath) {
-		return link.Path, nil
+	defer func() {
+		// 重命名成功后临时文件已不存在
+		_ = os.Remove(tmp)
+	}()
+	if fixExt {
+		storePath = FixImageExt(storePath, ext)
 	}
-	if err = Download(imgURL, storePath); err != nil {
+	if err = os.Rename(tmp, storePath); err != nil {
 		return "", err
 	}
-	return link.Path, nil
+	return storePath, nil
 }
 
-func Download(target, storePath string) error {
+// fetchImage 下载并校验图片，写入 dir 中的临时文件
+// 返回临时文件名、按文件头识别的扩展名与内容的 SHA-256，失败时不会留下临时文件
+func fetchImage(ctx context.Context, target, dir string) (string, string, string, error) {
 	var req *http.Request
 	var err error
-	req, err = http.NewRequest(http.MethodGet, target, nil)
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
 	if err != nil {
-		return err
+		return "", "", "", err
 	}
 	req.Header.Add("User-Agent", UserAgentChrome)
 	var resp *http.Response
-	if resp, err = http.DefaultClient.Do(req); err != nil {
-		return err
+	if resp, err = DownloadClient.Do(req); err != nil {
+		return "", "", "", err
 	}
-	if err = os.MkdirAll("./"+path.Dir(storePath), 0755); err != nil {
-		return err
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", "", "", &StatusError{URL: target, StatusCode: resp.StatusCode}
+	}
+	if ct := resp.Header.Get("Content-Type"); strings.HasPrefix(ct, "text/") {
+		return "", "", "", fmt.Errorf("%w: %s: content type %s", ErrInvalidImage, target, ct)
+	}
+	if resp.ContentLength > ImageMaxSize {
+		return "", "", "", fmt.Errorf("%w: %s: %d bytes", ErrImageTooLarge, target, resp.ContentLength)
+	}
+	head := make([]byte, sniffLen)
+	var n int
+	if n, err = io.ReadFull(resp.Body, head); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", "", "", err
+	}
+	head = head[:n]
+	ext := SniffImage(head)
+	if ext == "" {
+		return "", "", "", fmt.Errorf("%w: %s: unknown format", ErrInvalidImage, target)
 	}
 	var save *os.File
-	if save, err = os.Create(storePath); err != nil {
+	if save, err = os.CreateTemp(dir, ".download.*.tmp"); err != nil {
+		return "", "", "", err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			_ = os.Remove(save.Name())
+		}
+	}()
+	hash := sha256.New()
+	var size int64
+	if err = save.Chmod(WriteFileMode); err == nil {
+		body := io.MultiReader(bytes.NewReader(head), io.LimitReader(resp.Body, ImageMaxSize-int64(n)+1))
+		size, err = io.Copy(io.MultiWriter(save, hash), body)
+	}
+	if closeErr := save.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	if size > ImageMaxSize {
+		return "", "", "", fmt.Errorf("%w: %s: more than %d bytes", ErrImageTooLarge, target, ImageMaxSize)
+	}
+	if size < ImageMinSize {
+		return "", "", "", fmt.Errorf("%w: %s: %d bytes", ErrImageTooSmall, target, size)
+	}
+	ok = true
+	return save.Name(), ext, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Uploader 往宝塔面板上传文件，*bt.Session 与 *panel.Client 都实现了该接口
+type Uploader interface {
+	UploadWithTimeout(timeout time.Duration, name, serverPath string, fp *os.File, overwrite bool) error
+}
+
+var _ Uploader = (*bt.Session)(nil)
+
+// UploadImage 往宝塔上传文件
+// imgPath 与 siteRootPath 的拼接经过 SafeJoin，不会超出站点的根目录；失败时可通过 UploadQueue 重试。
+// 站点设置了 SetImageProcess 时上传处理后的图片，本地的原图不变
+func UploadImage(u Uploader, siteRootPath, imgPath string) error {
+	var imgRootPath, serverPath string
+	var err error
+	if imgRootPath, err = SafeJoin(ImgRootPath, imgPath); err == nil {
+		serverPath, err = SafeJoin(siteRootPath, imgPath)
+	}
+	if err != nil {
 		return err
 	}
-	if _, err = io.Copy(save, resp.Body); err != nil {
+	var fp *os.File
+	if proc, ok := GetImageProcess(siteRootPath); ok {
+		fp, err = processedImage(proc, imgRootPath)
+	} else {
+		fp, err = os.Open(imgRootPath)
+	}
+	if err != nil {
 		return err
 	}
-	return nil
+	defer func() {
+		_ = fp.Close()
+		if fp.Name() != imgRootPath {
+			_ = os.Remove(fp.Name())
+		}
+	}()
+	return u.UploadWithTimeout(UploadTimeout, imgRootPath, path.Dir(serverPath), fp, true)
 }
 
-// UploadImage 往宝塔上传文件
-func UploadImage(s *bt.Session, siteRootPath, imgPath string) {
-	imgRootPath := ImgRootPath + imgPath
+// processedImage 按 proc 处理图片，结果写入临时文件，返回已定位到开头的文件
+func processedImage(proc ImageProcess, name string) (*os.File, error) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if raw, err = proc.Apply(raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
 	var fp *os.File
-	var err error
-	if fp, err = os.Open(imgRootPath); err != nil {
-		return
+	if fp, err = os.CreateTemp("", "upload-*"+filepath.Ext(name)); err != nil {
+		return nil, err
 	}
-	serverPath := path.Dir(siteRootPath + imgPath)
-	if err = s.UploadWithTimeout(UploadTimeout, imgRootPath, serverPath, fp, true); err != nil {
-		log.Printf("图片上传失败，请手动完成，%s。Error: %v", imgRootPath, err)
-		return
+	if _, err = fp.Write(raw); err == nil {
+		_, err = fp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = fp.Close()
+		_ = os.Remove(fp.Name())
+		return nil, err
 	}
+	return fp, nil
 }
 
 // PathExists 路径或文件是否存在 true存在 false不存在
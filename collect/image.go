@@ -0,0 +1,147 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path"
+	"strings"
+)
+
+var ErrImageTooSmall = errors.New("image too small")
+var ErrImageTooLarge = errors.New("image too large")
+
+// ImageMinSize 图片的最小字节数，小于它的通常是统计用的像素图或空文件
+var ImageMinSize int64 = 64
+
+// ImageMaxSize 图片的最大字节数
+var ImageMaxSize int64 = 20 << 20
+
+// ImageStatus 图片的处理结果
+type ImageStatus string
+
+const (
+	ImageOK      ImageStatus = "ok"      // 已下载
+	ImageFailed  ImageStatus = "failed"  // 下载失败，如：网络错误、非 2xx 的响应
+	ImageInvalid ImageStatus = "invalid" // 不是有效的图片，如：无法识别的格式、过小或过大、链接无效
+)
+
+// ImageRecord 文章中一张图片的记录，下载失败的图片也会记录
+type ImageRecord struct {
+	URL    string      `json:"url"`              // 原始链接
+	Path   string      `json:"path,omitempty"`   // 相对 ImgRootPath 的保存路径，同 LocalImages
+	Width  int         `json:"width,omitempty"`  // 宽度，无法解析时为 0
+	Height int         `json:"height,omitempty"` // 高度，无法解析时为 0
+	Size   int64       `json:"size,omitempty"`   // 字节数
+	MIME   string      `json:"mime,omitempty"`   // 如：image/png
+	SHA256 string      `json:"sha256,omitempty"` // 内容的 SHA-256
+	Status ImageStatus `json:"status"`
+	Error  string      `json:"error,omitempty"` // 失败的原因
+
+	Variants []ImageVariant `json:"variants,omitempty"` // 缩略图，按宽度从小到大，见 GenerateVariants
+}
+
+// imageMIME 扩展名对应的 MIME 类型
+var imageMIME = map[string]string{
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// DownloadImageRecord 同 DownloadImageContext，返回图片的记录
+// 失败时 Status 为 ImageFailed 或 ImageInvalid，Error 为失败的原因
+func DownloadImageRecord(ctx context.Context, imgURL string) ImageRecord {
+	rec, _ := downloadImageRecord(ctx, imgURL)
+	return rec
+}
+
+// downloadImageRecord 同 DownloadImageRecord，同时返回失败时的错误
+func downloadImageRecord(ctx context.Context, imgURL string) (ImageRecord, error) {
+	rec := ImageRecord{URL: strings.TrimSpace(imgURL)}
+	p, err := DownloadImageContext(ctx, imgURL)
+	if err == nil {
+		rec, err = StatImage(p)
+		rec.URL = strings.TrimSpace(imgURL)
+	}
+	if err != nil {
+		rec.Status, rec.Error = ImageFailed, err.Error()
+		if errors.Is(err, ErrInvalidImage) || errors.Is(err, ErrImageTooSmall) || errors.Is(err, ErrImageTooLarge) ||
+			errors.Is(err, ErrNotFile) || errors.Is(err, ErrNotScheme) || errors.Is(err, ErrUnsafePath) {
+			rec.Status = ImageInvalid
+		}
+	}
+	return rec, err
+}
+
+// StatImage 读取已下载图片的信息，p 为相对 ImgRootPath 的路径
+func StatImage(p string) (ImageRecord, error) {
+	raw, err := os.ReadFile(ImgRootPath + p)
+	if err != nil {
+		return ImageRecord{}, err
+	}
+	sum := sha256.Sum256(raw)
+	rec := ImageRecord{
+		Path:   p,
+		Size:   int64(len(raw)),
+		MIME:   imageMIME[SniffImage(raw)],
+		SHA256: hex.EncodeToString(sum[:]),
+		Status: ImageOK,
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(raw)); err == nil {
+		rec.Width, rec.Height = cfg.Width, cfg.Height
+	}
+	return rec, nil
+}
+
+// sniffLen SniffImage 需要的字节数
+const sniffLen = 12
+
+// imageExts 可识别的图片格式的扩展名
+var imageExts = []string{".jpg", ".png", ".gif", ".webp"}
+
+// SniffImage 按文件头识别图片格式，返回对应的扩展名，如：.jpg，无法识别时返回空字符串
+// 支持 JPEG、PNG、GIF、WebP，head 至少需要 12 字节
+func SniffImage(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return ".jpg"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return ".png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return ".gif"
+	case len(head) >= sniffLen && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WEBP":
+		return ".webp"
+	}
+	return ""
+}
+
+// isImageExt ext 是否是图片的扩展名，.jpeg 与 .jpg 视为相同
+func isImageExt(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp":
+		return true
+	}
+	return false
+}
+
+// FixImageExt 使 p 的扩展名与图片格式 ext 一致
+// p 的扩展名是其它图片格式时替换，不是图片的扩展名时追加，避免不同的文件改名后重名
+func FixImageExt(p, ext string) string {
+	cur := path.Ext(p)
+	if strings.EqualFold(cur, ext) || (ext == ".jpg" && strings.EqualFold(cur, ".jpeg")) {
+		return p
+	}
+	if isImageExt(cur) {
+		return strings.TrimSuffix(p, cur) + ext
+	}
+	return p + ext
+}
@@ -0,0 +1,215 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPNG 带 PNG 文件头的测试数据
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 100)...)
+
+func TestSniffImage(t *testing.T) {
+	cases := map[string]string{
+		"\xFF\xD8\xFF\xE0\x00\x10JFIF\x00":  ".jpg",
+		"\x89PNG\r\n\x1a\n\x00\x00\x00\x0d": ".png",
+		"GIF89a\x01\x00\x01\x00\x80\x00":    ".gif",
+		"RIFF\x24\x00\x00\x00WEBPVP8 ":      ".webp",
+		"RIFF\x24\x00\x00\x00WAVEfmt ":      "",
+		"<!DOCTYPE html><html>":             "",
+	}
+	for head, want := range cases {
+		if got := SniffImage([]byte(head)); got != want {
+			t.Errorf("SniffImage(%q) = %q, want %q", head, got, want)
+		}
+	}
+}
+
+func TestFixImageExt(t *testing.T) {
+	cases := []struct{ in, ext, want string }{
+		{"/a/b.png", ".png", "/a/b.png"},
+		{"/a/b.JPEG", ".jpg", "/a/b.JPEG"},
+		{"/a/b.jpg", ".webp", "/a/b.webp"},
+		{"/a/b_800.image", ".png", "/a/b_800.image.png"},
+		{"/newsapp/641", ".gif", "/newsapp/641.gif"},
+	}
+	for _, c := range cases {
+		if got := FixImageExt(c.in, c.ext); got != c.want {
+			t.Errorf("FixImageExt(%q, %q) = %q, want %q", c.in, c.ext, got, c.want)
+		}
+	}
+}
+
+func TestDownloadImageValidate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a/real-png.jpg", "/a/no-ext":
+			_, _ = w.Write(testPNG)
+		case "/a/error.png":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<html>not found</html>"))
+		case "/a/garbage.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(bytes.Repeat([]byte{1}, 200))
+		case "/a/pixel.gif":
+			_, _ = w.Write([]byte("GIF89a\x01\x00\x01\x00\x80\x00\x00"))
+		case "/a/huge.png":
+			_, _ = w.Write(append(testPNG, make([]byte, 1024)...))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	root, retry, maxSize, hashed := ImgRootPath, Retry, ImageMaxSize, ImageContentAddressed
+	ImgRootPath, Retry, ImageMaxSize, ImageContentAddressed = t.TempDir(), RetryPolicy{MaxAttempts: 1}, 512, false
+	defer func() {
+		ImgRootPath, Retry, ImageMaxSize, ImageContentAddressed = root, retry, maxSize, hashed
+	}()
+
+	for in, want := range map[string]string{"/a/real-png.jpg": "/a/real-png.png", "/a/no-ext": "/a/no-ext.png"} {
+		got, err := DownloadImage(srv.URL + in)
+		if err != nil || got != want {
+			t.Fatalf("DownloadImage(%s) = %q, error:%v", in, got, err)
+		}
+		if raw, _ := os.ReadFile(ImgRootPath + got); !bytes.Equal(raw, testPNG) {
+			t.Fatalf("%s: saved %d bytes", got, len(raw))
+		}
+		// 再次下载时找到改过扩展名的文件
+		if got, err = DownloadImage(srv.URL + in); err != nil || got != want {
+			t.Fatalf("DownloadImage(%s) again = %q, error:%v", in, got, err)
+		}
+	}
+
+	var se *StatusError
+	cases := map[string]func(error) bool{
+		"/a/missing.png": func(err error) bool { return errors.As(err, &se) && se.StatusCode == http.StatusNotFound },
+		"/a/error.png":   func(err error) bool { return errors.Is(err, ErrInvalidImage) },
+		"/a/garbage.png": func(err error) bool { return errors.Is(err, ErrInvalidImage) },
+		"/a/pixel.gif":   func(err error) bool { return errors.Is(err, ErrImageTooSmall) },
+		"/a/huge.png":    func(err error) bool { return errors.Is(err, ErrImageTooLarge) },
+	}
+	for in, check := range cases {
+		if _, err := DownloadImage(srv.URL + in); !check(err) {
+			t.Errorf("DownloadImage(%s) error:%v", in, err)
+		}
+	}
+	// 失败的下载不应留下任何文件
+	_ = filepath.Walk(ImgRootPath, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			if rel, _ := filepath.Rel(ImgRootPath, p); rel != filepath.Join("a", "real-png.png") && rel != filepath.Join("a", "no-ext.png") {
+				t.Errorf("unexpected file %s", rel)
+			}
+		}
+		return nil
+	})
+}
+
+func TestDownloadImageHashed(t *testing.T) {
+	other := append([]byte("\xFF\xD8\xFF\xE0"), bytes.Repeat([]byte{2}, 100)...)
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		switch r.URL.Path {
+		case "/a/1.png", "/b/copy.jpg":
+			_, _ = w.Write(testPNG)
+		case "/a/2.png":
+			_, _ = w.Write(other)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	root, retry, hashed := ImgRootPath, Retry, ImageContentAddressed
+	ImgRootPath, Retry, ImageContentAddressed = t.TempDir(), RetryPolicy{MaxAttempts: 1}, true
+	defer func() {
+		ImgRootPath, Retry, ImageContentAddressed = root, retry, hashed
+	}()
+
+	first, err := DownloadImage(srv.URL + "/a/1.png")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	sum := sha256.Sum256(testPNG)
+	if want := HashImagePath(hex.EncodeToString(sum[:]), ".png"); first != want {
+		t.Fatalf("path=%q, want %q", first, want)
+	}
+	// 相同内容的图片只保存一份
+	copied, err := DownloadImage(srv.URL + "/b/copy.jpg")
+	if err != nil || copied != first {
+		t.Fatalf("copy=%q error:%v", copied, err)
+	}
+	second, err := DownloadImage(srv.URL + "/a/2.png")
+	if err != nil || second == first || !strings.HasSuffix(second, ".jpg") {
+		t.Fatalf("second=%q error:%v", second, err)
+	}
+	// 已下载的地址不再请求
+	if again, err := DownloadImage(srv.URL + "/a/1.png"); err != nil || again != first || hits != 3 {
+		t.Fatalf("again=%q hits=%d error:%v", again, hits, err)
+	}
+	files := 0
+	_ = filepath.Walk(ImgRootPath+ImageHashDir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files++
+		}
+		return nil
+	})
+	if files != 2 {
+		t.Fatalf("%d files, want 2", files)
+	}
+	index, err := OpenImageIndex(filepath.Join(ImgRootPath, ImageIndexName))
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if e, ok := index.Lookup(srv.URL + "/b/copy.jpg"); !ok || e.Path != first || e.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("index entry=%+v", e)
+	}
+	if index.Len() != 3 {
+		t.Fatalf("index len=%d", index.Len())
+	}
+}
+
+func TestDownloadImageRecord(t *testing.T) {
+	png, err := os.ReadFile("testdata/selector/img.png")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.png":
+			_, _ = w.Write(png)
+		case "/page.png":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	root, retry := ImgRootPath, Retry
+	ImgRootPath, Retry = t.TempDir(), RetryPolicy{MaxAttempts: 1}
+	defer func() {
+		ImgRootPath, Retry = root, retry
+	}()
+
+	rec := DownloadImageRecord(context.Background(), srv.URL+"/a.png")
+	if rec.Status != ImageOK || rec.Width != 4 || rec.Height != 3 || rec.Size != int64(len(png)) ||
+		rec.MIME != "image/png" || rec.URL != srv.URL+"/a.png" || rec.Path != "/a.png" || rec.SHA256 == "" {
+		t.Fatalf("record=%+v", rec)
+	}
+	for in, want := range map[string]ImageStatus{"/page.png": ImageInvalid, "/missing.png": ImageFailed, "data:image/png;base64,xx": ImageInvalid} {
+		if in[0] == '/' {
+			in = srv.URL + in
+		}
+		if rec = DownloadImageRecord(context.Background(), in); rec.Status != want || rec.Error == "" || rec.Path != "" {
+			t.Errorf("%s: record=%+v", in, rec)
+		}
+	}
+}
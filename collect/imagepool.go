@@ -0,0 +1,105 @@
+package collect
+
+import (
+	"context"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"strings"
+	"sync"
+)
+
+// ImageConcurrency 每篇文章同时下载的图片数
+var ImageConcurrency = 4
+
+// ImagesError 文章中部分图片下载失败，每张图片的原因也记录在 Article.Images 中
+type ImagesError struct {
+	Total int     // 图片总数
+	Errs  []error // 每张失败图片的错误，按在文章中的顺序
+}
+
+func (e *ImagesError) Error() string {
+	return fmt.Sprintf("%d of %d images failed, first error: %v", len(e.Errs), e.Total, e.Errs[0])
+}
+
+func (e *ImagesError) Unwrap() []error {
+	return e.Errs
+}
+
+// DownloadImages 并发下载 sel 中每个元素的图片，同时下载的数量不超过 ImageConcurrency
+// src 返回元素的图片链接，返回空字符串时跳过该元素；同一链接只下载一次。
+// 下载成功的图片按 ThumbnailSizes 生成缩略图，生成失败时只是没有缩略图。
+// 全部下载结束后按文档顺序处理每个元素：记录追加到 art.Images，成功时将 src 改为本地路径、设置 srcset，
+// 原图与缩略图追加到 art.LocalImages，然后调用 fn；fn 为 nil 时移除下载失败的元素。
+// 有图片失败时返回 *ImagesError，ctx 取消或超时时返回 ctx.Err() 且不修改文档
+func DownloadImages(ctx context.Context, art *Article, sel *goquery.Selection, src func(el *goquery.Selection) string, fn func(el *goquery.Selection, rec ImageRecord)) error {
+	type item struct {
+		el  *goquery.Selection
+		url int // urls 中的下标
+	}
+	items := make([]item, 0)
+	urls := make([]string, 0)
+	index := make(map[string]int)
+	// goquery 不能并发修改，先在当前 goroutine 中取出全部链接
+	sel.Each(func(_ int, el *goquery.Selection) {
+		u := strings.TrimSpace(src(el))
+		if u == "" {
+			return
+		}
+		i, ok := index[u]
+		if !ok {
+			i = len(urls)
+			index[u] = i
+			urls = append(urls, u)
+		}
+		items = append(items, item{el: el, url: i})
+	})
+	limit := ImageConcurrency
+	if limit <= 0 {
+		limit = 1
+	}
+	records := make([]ImageRecord, len(urls))
+	errs := make([]error, len(urls))
+	sem := make(semaphore, limit)
+	wg := &sync.WaitGroup{}
+	for i := range urls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := sem.acquire(ctx); err != nil {
+				return
+			}
+			defer sem.release()
+			if records[i], errs[i] = downloadImageRecord(ctx, urls[i]); errs[i] == nil {
+				records[i].Variants, _ = GenerateVariants(records[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	failed := make([]error, 0)
+	for _, it := range items {
+		rec := records[it.url]
+		art.Images = append(art.Images, rec)
+		if rec.Status == ImageOK {
+			it.el.SetAttr("src", rec.Path)
+			SetSrcset(it.el, rec)
+			art.LocalImages = append(art.LocalImages, rec.Path)
+			for _, v := range rec.Variants {
+				art.LocalImages = append(art.LocalImages, v.Path)
+			}
+		} else {
+			failed = append(failed, errs[it.url])
+		}
+		if fn != nil {
+			fn(it.el, rec)
+		} else if rec.Status != ImageOK {
+			it.el.Remove()
+		}
+	}
+	if len(failed) > 0 {
+		return &ImagesError{Total: len(items), Errs: failed}
+	}
+	return nil
+}
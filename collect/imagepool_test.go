@@ -0,0 +1,87 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"github.com/PuerkitoBio/goquery"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadImages(t *testing.T) {
+	png, err := os.ReadFile("testdata/selector/img.png")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	mu := &sync.Mutex{}
+	running, peak, hits := 0, 0, make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		if running++; running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(png)
+	}))
+	defer srv.Close()
+	root, retry, limit, hashed := ImgRootPath, Retry, ImageConcurrency, ImageContentAddressed
+	ImgRootPath, Retry, ImageConcurrency, ImageContentAddressed = t.TempDir(), RetryPolicy{MaxAttempts: 1}, 2, true
+	defer func() {
+		ImgRootPath, Retry, ImageConcurrency, ImageContentAddressed = root, retry, limit, hashed
+	}()
+
+	page := `<div><img src="/1.png"><img src="/missing.png"><img src=""><img src="/2.png"><img src="/1.png"><img src="/3.png"></div>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(strings.ReplaceAll(page, `src="/`, `src="`+srv.URL+`/`)))
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	art := &Article{}
+	var order []string
+	err = DownloadImages(context.Background(), art, doc.Find("img"), func(el *goquery.Selection) string {
+		return el.AttrOr("src", "")
+	}, func(el *goquery.Selection, rec ImageRecord) {
+		order = append(order, strings.TrimPrefix(rec.URL, srv.URL))
+		if rec.Status != ImageOK {
+			el.Remove()
+		}
+	})
+	var ie *ImagesError
+	var se *StatusError
+	if !errors.As(err, &ie) || ie.Total != 5 || len(ie.Errs) != 1 || !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Fatalf("error:%v", err)
+	}
+	if strings.Join(order, ",") != "/1.png,/missing.png,/2.png,/1.png,/3.png" {
+		t.Fatalf("order=%v", order)
+	}
+	if len(art.Images) != 5 || art.Images[1].Status != ImageFailed || len(art.LocalImages) != 4 {
+		t.Fatalf("images=%+v local=%v", art.Images, art.LocalImages)
+	}
+	if hits["/1.png"] != 1 {
+		t.Errorf("/1.png downloaded %d times", hits["/1.png"])
+	}
+	if peak > 2 {
+		t.Errorf("%d concurrent downloads, limit 2", peak)
+	}
+	doc.Find("img").Each(func(_ int, el *goquery.Selection) {
+		if src := el.AttrOr("src", ""); src != "" && !strings.HasPrefix(src, ImageHashDir+"/") {
+			t.Errorf("src not rewritten: %s", src)
+		}
+	})
+	if n := doc.Find("img").Length(); n != 5 {
+		t.Errorf("%d images left, want 5", n)
+	}
+}
@@ -0,0 +1,424 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"gopkg.in/yaml.v3"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidWatermark = errors.New("invalid watermark")
+var ErrStripMetadata = errors.New("cannot strip image metadata")
+
+// ImageReencodeQuality 重新编码 JPEG 的质量，1 ~ 100
+var ImageReencodeQuality = 90
+
+// WatermarkPosition 水印的位置
+type WatermarkPosition string
+
+const (
+	WatermarkTopLeft     WatermarkPosition = "top-left"
+	WatermarkTopRight    WatermarkPosition = "top-right"
+	WatermarkBottomLeft  WatermarkPosition = "bottom-left"
+	WatermarkBottomRight WatermarkPosition = "bottom-right"
+)
+
+// Watermark 水印，Image 与 Text 二选一，都设置时使用 Image
+type Watermark struct {
+	Text     string            `json:"text" yaml:"text"`           // 文字
+	Font     string            `json:"font" yaml:"font"`           // TrueType 或 OpenType 字体文件，为空时使用内置的点阵字体，只支持 ASCII 字符
+	FontSize float64           `json:"font_size" yaml:"font_size"` // 字号，只对 Font 有效，<= 0 时为 24
+	Image    string            `json:"image" yaml:"image"`         // PNG 图片的路径
+	Position WatermarkPosition `json:"position" yaml:"position"`   // 为空时为 bottom-right
+	Opacity  float64           `json:"opacity" yaml:"opacity"`     // 不透明度，0 ~ 1，<= 0 时为 0.5
+	Margin   int               `json:"margin" yaml:"margin"`       // 与边缘的距离，<= 0 时为 10
+	MinWidth int               `json:"min_width" yaml:"min_width"` // 宽或高小于它的图片不加水印，<= 0 时为 200
+}
+
+// ImageProcess 上传到站点前对图片的处理
+// 处理时重新编码图片，因此会去掉 EXIF 等元数据；JPEG 会先按 EXIF 中的方向旋转。
+// WebP 没有编码器，原样上传；GIF 保留动画，不加水印
+type ImageProcess struct {
+	StripMetadata bool       `json:"strip_metadata" yaml:"strip_metadata"` // 去掉元数据
+	Watermark     *Watermark `json:"watermark" yaml:"watermark"`           // 水印，为 nil 时不加
+
+	mark *image.RGBA // 水印的图案，由 SetImageProcess 准备
+}
+
+var imageProcess = make(map[string]ImageProcess)
+var ipm = &sync.RWMutex{}
+
+// SetImageProcess 设置站点上传图片前的处理，siteRoot 为站点在服务器上的根目录，与 UploadImage 的 siteRootPath 相同
+// 水印的图片或字体无法读取时返回错误
+func SetImageProcess(siteRoot string, p ImageProcess) error {
+	if p.Watermark != nil {
+		mark, err := p.Watermark.render()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidWatermark, siteRoot, err)
+		}
+		p.mark = mark
+	}
+	ipm.Lock()
+	defer ipm.Unlock()
+	imageProcess[strings.TrimRight(siteRoot, "/")] = p
+	return nil
+}
+
+// GetImageProcess 站点上传图片前的处理，未设置时返回 false
+func GetImageProcess(siteRoot string) (ImageProcess, bool) {
+	ipm.RLock()
+	defer ipm.RUnlock()
+	p, ok := imageProcess[strings.TrimRight(siteRoot, "/")]
+	return p, ok
+}
+
+// LoadImageProcess 读取各站点的图片处理配置并调用 SetImageProcess，按扩展名识别 .json .yaml .yml
+// 文件内容为 站点根目录 -> ImageProcess
+func LoadImageProcess(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sites := make(map[string]ImageProcess)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(raw, &sites)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &sites)
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidDefinition, path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for siteRoot, p := range sites {
+		if err = SetImageProcess(siteRoot, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// render 水印的图案，文字为白色并带黑色阴影
+func (w *Watermark) render() (*image.RGBA, error) {
+	if w.Image != "" {
+		fp, err := os.Open(w.Image)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = fp.Close()
+		}()
+		img, err := png.Decode(fp)
+		if err != nil {
+			return nil, err
+		}
+		mark := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+		draw.Draw(mark, mark.Bounds(), img, img.Bounds().Min, draw.Src)
+		return mark, nil
+	}
+	if w.Text == "" {
+		return nil, errors.New("neither image nor text")
+	}
+	var face font.Face = basicfont.Face7x13
+	if w.Font != "" {
+		raw, err := os.ReadFile(w.Font)
+		if err != nil {
+			return nil, err
+		}
+		f, err := opentype.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		size := w.FontSize
+		if size <= 0 {
+			size = 24
+		}
+		if face, err = opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull}); err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = face.Close()
+		}()
+	}
+	metrics := face.Metrics()
+	width := font.MeasureString(face, w.Text).Ceil()
+	height := (metrics.Ascent + metrics.Descent).Ceil()
+	mark := image.NewRGBA(image.Rect(0, 0, width+1, height+1))
+	d := &font.Drawer{Dst: mark, Src: image.Black, Face: face, Dot: fixed.Point26_6{X: fixed.I(1), Y: metrics.Ascent + fixed.I(1)}}
+	d.DrawString(w.Text)
+	d.Src, d.Dot = image.White, fixed.Point26_6{Y: metrics.Ascent}
+	d.DrawString(w.Text)
+	return mark, nil
+}
+
+// apply 在 img 上绘制水印，图片过小或放不下水印时不绘制
+func (w *Watermark) apply(img draw.Image, mark *image.RGBA) {
+	b := img.Bounds()
+	minWidth, margin, opacity := w.MinWidth, w.Margin, w.Opacity
+	if minWidth <= 0 {
+		minWidth = 200
+	}
+	if margin <= 0 {
+		margin = 10
+	}
+	if opacity <= 0 || opacity > 1 {
+		opacity = 0.5
+	}
+	mw, mh := mark.Bounds().Dx(), mark.Bounds().Dy()
+	if b.Dx() < minWidth || b.Dy() < minWidth || mw+2*margin > b.Dx() || mh+2*margin > b.Dy() {
+		return
+	}
+	pt := image.Pt(b.Max.X-margin-mw, b.Max.Y-margin-mh)
+	switch w.Position {
+	case WatermarkTopLeft:
+		pt = image.Pt(b.Min.X+margin, b.Min.Y+margin)
+	case WatermarkTopRight:
+		pt.Y = b.Min.Y + margin
+	case WatermarkBottomLeft:
+		pt.X = b.Min.X + margin
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity*255 + 0.5)})
+	draw.DrawMask(img, image.Rectangle{Min: pt, Max: pt.Add(image.Pt(mw, mh))}, mark, image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// Apply 按 p 处理图片 raw，返回新的内容，不需要处理时原样返回
+// WebP 只去掉元数据，不加水印；需要去掉元数据而格式无法识别时返回 ErrStripMetadata，以免带着元数据上传；
+// 图片无法解码时返回 ErrInvalidImage，像素数超过 ThumbnailMaxPixels 时不解码，返回 ErrImageTooLarge
+func (p ImageProcess) Apply(raw []byte) ([]byte, error) {
+	if !p.StripMetadata && p.Watermark == nil {
+		return raw, nil
+	}
+	buf := &bytes.Buffer{}
+	switch SniffImage(raw) {
+	case ".jpg":
+		if err := checkPixels(raw); err != nil {
+			return nil, err
+		}
+		src, err := jpeg.Decode(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		img := orient(src, jpegOrientation(raw))
+		p.watermark(img)
+		if err = jpeg.Encode(buf, img, &jpeg.Options{Quality: ImageReencodeQuality}); err != nil {
+			return nil, err
+		}
+	case ".png":
+		if err := checkPixels(raw); err != nil {
+			return nil, err
+		}
+		src, err := png.Decode(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		img := image.NewNRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+		draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+		p.watermark(img)
+		if err = png.Encode(buf, img); err != nil {
+			return nil, err
+		}
+	case ".gif":
+		if err := checkPixels(raw); err != nil {
+			return nil, err
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		if err = gif.EncodeAll(buf, g); err != nil {
+			return nil, err
+		}
+	case ".webp":
+		if !p.StripMetadata {
+			return raw, nil
+		}
+		return stripWebP(raw)
+	default:
+		if p.StripMetadata {
+			return nil, fmt.Errorf("%w: unknown image format", ErrStripMetadata)
+		}
+		return raw, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// checkPixels 只读取文件头中的尺寸，像素数超过 ThumbnailMaxPixels 时返回 ErrImageTooLarge，
+// 避免很小的文件声明很大的尺寸，解码时占用过多内存
+func checkPixels(raw []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > int64(ThumbnailMaxPixels) {
+		return fmt.Errorf("%w: %dx%d pixels", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// stripWebP 去掉 WebP 中的 EXIF 与 XMP 块，并清除 VP8X 中对应的标志，其它块原样保留
+func stripWebP(raw []byte) ([]byte, error) {
+	if len(raw) < 12 || string(raw[:4]) != "RIFF" || string(raw[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("%w: malformed webp", ErrStripMetadata)
+	}
+	r := append([]byte{}, raw[:12]...)
+	for i := 12; i < len(raw); {
+		if i+8 > len(raw) {
+			return nil, fmt.Errorf("%w: malformed webp", ErrStripMetadata)
+		}
+		size := int(binary.LittleEndian.Uint32(raw[i+4 : i+8]))
+		// 块的长度为奇数时后面有一个填充字节，最后一块的填充字节可能省略
+		end := i + 8 + size + size&1
+		if end > len(raw) && i+8+size == len(raw) {
+			end = len(raw)
+		}
+		if end > len(raw) || size < 0 {
+			return nil, fmt.Errorf("%w: malformed webp", ErrStripMetadata)
+		}
+		switch string(raw[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, raw[i:end]...)
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF 与 XMP 标志
+			}
+			r = append(r, chunk...)
+		default:
+			r = append(r, raw[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(r[4:8], uint32(len(r)-8))
+	return r, nil
+}
+
+func (p ImageProcess) watermark(img draw.Image) {
+	if p.Watermark != nil && p.mark != nil {
+		p.Watermark.apply(img, p.mark)
+	}
+}
+
+// jpegOrientation JPEG 的 EXIF 中记录的方向，1 ~ 8，没有时为 1
+func jpegOrientation(raw []byte) int {
+	if len(raw) < 4 || raw[0] != 0xFF || raw[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(raw); {
+		if raw[i] != 0xFF {
+			return 1
+		}
+		marker := raw[i+1]
+		switch {
+		case marker == 0xFF:
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8):
+			i += 2
+			continue
+		case marker == 0xDA:
+			// 图像数据开始，之后不会再有 EXIF
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(raw[i+2:]))
+		if size < 2 || i+2+size > len(raw) {
+			return 1
+		}
+		seg := raw[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation 从 TIFF 格式的 EXIF 数据的 IFD0 中读取 Orientation
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	off := int(order.Uint32(tiff[4:]))
+	if off < 8 || off+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[off:]))
+	for i := 0; i < n; i++ {
+		e := off + 2 + i*12
+		if e+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[e+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient 按 EXIF 的方向 o 翻转或旋转 src，返回可绘制的新图片
+func orient(src image.Image, o int) draw.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if o < 1 || o > 8 {
+		o = 1
+	}
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	if o == 1 {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+		return dst
+	}
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := x, y
+			switch o {
+			case 2:
+				sx = w - 1 - x
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sy = h - 1 - y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
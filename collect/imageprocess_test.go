@@ -0,0 +1,258 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withEXIF 在 JPEG 的文件头之后插入只含 Orientation 的 EXIF
+func withEXIF(raw []byte, orientation byte) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00")
+	tiff = append(tiff, orientation, 0, 0, 0, 0, 0, 0)
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	r := append([]byte{}, raw[:2]...)
+	r = append(r, 0xFF, 0xE1, byte((len(seg)+2)>>8), byte(len(seg)+2))
+	r = append(r, seg...)
+	return append(r, raw[2:]...)
+}
+
+// solidImage w x h 的纯色图片
+func solidImage(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestImageProcessOrientation(t *testing.T) {
+	// 左红右蓝，方向 6 表示需要顺时针旋转 90 度，旋转后上红下蓝
+	img := solidImage(40, 20, color.RGBA{B: 255, A: 255})
+	draw.Draw(img, image.Rect(0, 0, 20, 20), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	raw := withEXIF(buf.Bytes(), 6)
+	if o := jpegOrientation(raw); o != 6 {
+		t.Fatalf("orientation=%d", o)
+	}
+	out, err := ImageProcess{StripMetadata: true}.Apply(raw)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if bytes.Contains(out, []byte("Exif")) || jpegOrientation(out) != 1 {
+		t.Fatalf("metadata was not stripped")
+	}
+	got, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if b := got.Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+		t.Fatalf("bounds=%v", b)
+	}
+	if r, _, b, _ := got.At(10, 5).RGBA(); r>>8 < 200 || b>>8 > 50 {
+		t.Fatalf("top is not red: %v", got.At(10, 5))
+	}
+	if r, _, b, _ := got.At(10, 35).RGBA(); b>>8 < 200 || r>>8 > 50 {
+		t.Fatalf("bottom is not blue: %v", got.At(10, 35))
+	}
+
+	// 不需要处理与没有元数据的 WebP 原样返回
+	if out, _ = (ImageProcess{}).Apply(raw); !bytes.Equal(out, raw) {
+		t.Fatalf("unprocessed image changed")
+	}
+	webp := []byte("RIFF\x0c\x00\x00\x00WEBPVP8 \x00\x00\x00\x00")
+	if out, _ = (ImageProcess{StripMetadata: true}).Apply(webp); !bytes.Equal(out, webp) {
+		t.Fatalf("webp changed")
+	}
+}
+
+func TestImageProcessWatermark(t *testing.T) {
+	mark := filepath.Join(t.TempDir(), "mark.png")
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, solidImage(20, 10, color.White)); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if err := os.WriteFile(mark, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	buf.Reset()
+	if err := png.Encode(buf, solidImage(300, 200, color.Black)); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	raw := buf.Bytes()
+	gray := func(p ImageProcess, x, y int) uint32 {
+		t.Helper()
+		out, err := p.Apply(raw)
+		if err != nil {
+			t.Fatalf("error:%v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("error:%v", err)
+		}
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r >> 8
+	}
+	tests := []struct {
+		wm     Watermark
+		x, y   int
+		want   uint32
+		remark string
+	}{
+		{Watermark{Image: mark, Opacity: 1}, 285, 185, 255, "bottom-right"},
+		{Watermark{Image: mark, Opacity: 1}, 5, 5, 0, "outside"},
+		{Watermark{Image: mark, Opacity: 1, Position: WatermarkTopLeft, Margin: 5}, 5, 5, 255, "top-left"},
+		{Watermark{Image: mark, Opacity: 1, Position: WatermarkTopRight}, 285, 15, 255, "top-right"},
+		{Watermark{Image: mark, Position: WatermarkBottomLeft}, 15, 185, 128, "half opacity"},
+		{Watermark{Image: mark, Opacity: 1, MinWidth: 500}, 285, 185, 0, "image too small"},
+	}
+	for _, tt := range tests {
+		p := ImageProcess{Watermark: &tt.wm}
+		if err := SetImageProcess("/www/wwwroot/wm.test", p); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+		p, _ = GetImageProcess("/www/wwwroot/wm.test/")
+		if got := gray(p, tt.x, tt.y); got != tt.want {
+			t.Errorf("%s: pixel(%d,%d)=%d, want %d", tt.remark, tt.x, tt.y, got, tt.want)
+		}
+	}
+
+	// 文字水印使用内置字体
+	if err := SetImageProcess("/www/wwwroot/wm.test", ImageProcess{Watermark: &Watermark{Text: "example.com", Opacity: 1}}); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	p, _ := GetImageProcess("/www/wwwroot/wm.test")
+	if p.mark.Bounds().Dx() != 7*11+1 {
+		t.Fatalf("mark=%v", p.mark.Bounds())
+	}
+	lit := false
+	for x := 300 - 10 - 78; x < 290 && !lit; x++ {
+		for y := 200 - 10 - 14; y < 190 && !lit; y++ {
+			lit = gray(p, x, y) > 200
+		}
+	}
+	if !lit {
+		t.Fatalf("text watermark was not drawn")
+	}
+	if err := SetImageProcess("/www/wwwroot/wm.test", ImageProcess{Watermark: &Watermark{Image: mark + ".missing"}}); err == nil {
+		t.Fatalf("expected error")
+	}
+	ipm.Lock()
+	delete(imageProcess, "/www/wwwroot/wm.test")
+	ipm.Unlock()
+}
+
+func TestUploadImageProcess(t *testing.T) {
+	root := ImgRootPath
+	ImgRootPath = t.TempDir()
+	defer func() {
+		ImgRootPath = root
+	}()
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, solidImage(40, 20, color.White), nil); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	raw := withEXIF(buf.Bytes(), 1)
+	if err := os.MkdirAll(ImgRootPath+"/img/aa", 0755); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if err := os.WriteFile(ImgRootPath+"/img/aa/a.jpg", raw, 0644); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if err := SetImageProcess("/www/wwwroot/strip.test", ImageProcess{StripMetadata: true}); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	defer func() {
+		ipm.Lock()
+		delete(imageProcess, "/www/wwwroot/strip.test")
+		ipm.Unlock()
+	}()
+	up := &fakeUploader{files: make(map[string]string)}
+	for _, site := range []string{"/www/wwwroot/strip.test", "/www/wwwroot/plain.test"} {
+		if err := UploadImage(up, site, "/img/aa/a.jpg"); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+	}
+	if got := up.files["/www/wwwroot/strip.test/img/aa/a.jpg"]; got == "" || bytes.Contains([]byte(got), []byte("Exif")) {
+		t.Fatalf("uploaded %d bytes with metadata", len(got))
+	}
+	if got := up.files["/www/wwwroot/plain.test/img/aa/a.jpg"]; got != string(raw) {
+		t.Fatalf("image of a site without processing was changed")
+	}
+	if local, _ := os.ReadFile(ImgRootPath + "/img/aa/a.jpg"); !bytes.Equal(local, raw) {
+		t.Fatalf("local image was changed")
+	}
+}
+
+// webpChunk RIFF 中的一块，长度为奇数时补一个字节
+func webpChunk(fourCC string, payload []byte) []byte {
+	r := append([]byte(fourCC), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(r[4:], uint32(len(payload)))
+	r = append(r, payload...)
+	if len(payload)%2 == 1 {
+		r = append(r, 0)
+	}
+	return r
+}
+
+func TestImageProcessWebP(t *testing.T) {
+	vp8x := webpChunk("VP8X", []byte{0x08 | 0x04 | 0x10, 0, 0, 0, 3, 0, 0, 2, 0, 0})
+	vp8l := webpChunk("VP8L", []byte{0x2f, 1, 2, 3, 4})
+	body := append([]byte("WEBP"), vp8x...)
+	body = append(body, vp8l...)
+	body = append(body, webpChunk("EXIF", []byte("Exif\x00\x00MM\x00\x2a"))...)
+	body = append(body, webpChunk("XMP ", []byte("<x:xmpmeta/>"))...)
+	raw := append([]byte("RIFF\x00\x00\x00\x00"), body...)
+	binary.LittleEndian.PutUint32(raw[4:], uint32(len(body)))
+
+	got, err := ImageProcess{StripMetadata: true}.Apply(raw)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	want := append([]byte("RIFF\x00\x00\x00\x00WEBP"), vp8x...)
+	want[20] = 0x10
+	want = append(want, vp8l...)
+	binary.LittleEndian.PutUint32(want[4:], uint32(len(want)-8))
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+	if again, err := (ImageProcess{StripMetadata: true}).Apply(got); err != nil || !bytes.Equal(again, got) {
+		t.Fatalf("again=%q error:%v", again, err)
+	}
+	// 只加水印时 WebP 原样返回
+	if same, err := (ImageProcess{Watermark: &Watermark{Text: "x"}}).Apply(raw); err != nil || !bytes.Equal(same, raw) {
+		t.Fatalf("error:%v", err)
+	}
+	if _, err = (ImageProcess{StripMetadata: true}).Apply(raw[:len(raw)-3]); !errors.Is(err, ErrStripMetadata) {
+		t.Fatalf("truncated: error:%v", err)
+	}
+	// 无法识别的格式不能带着元数据上传
+	if _, err = (ImageProcess{StripMetadata: true}).Apply([]byte("BM\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")); !errors.Is(err, ErrStripMetadata) {
+		t.Fatalf("unknown format: error:%v", err)
+	}
+}
+
+func TestImageProcessMaxPixels(t *testing.T) {
+	// 只有文件头的 PNG，声明的尺寸为 100000x100000
+	ihdr := []byte("IHDR\x00\x01\x86\xa0\x00\x01\x86\xa0\x08\x06\x00\x00\x00")
+	raw := append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d"), ihdr...)
+	raw = binary.BigEndian.AppendUint32(raw, crc32.ChecksumIEEE(ihdr))
+	for _, p := range []ImageProcess{{StripMetadata: true}, {Watermark: &Watermark{Text: "example.com"}}} {
+		if _, err := p.Apply(raw); !errors.Is(err, ErrImageTooLarge) {
+			t.Fatalf("error:%v", err)
+		}
+	}
+	if _, err := (ImageProcess{StripMetadata: true}).Apply(testPNG); !errors.Is(err, ErrInvalidImage) {
+		t.Fatalf("error:%v", err)
+	}
+}
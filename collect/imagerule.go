@@ -0,0 +1,190 @@
+package collect
+
+import (
+	"github.com/cgghui/cgghui"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ImageTarget 图片的下载地址与本地保存位置
+type ImageTarget struct {
+	URL  string // 实际下载的地址
+	Path string // 相对 ImgRootPath 的保存路径，以 / 开头，不含扩展名，ResolveImage 返回时已经过 SafePath
+	Ext  string // 扩展名，如：.jpg，可以为空
+}
+
+// StorePath 相对 ImgRootPath 的完整保存路径，即 DownloadImage 的返回值
+func (t ImageTarget) StorePath() string {
+	return t.Path + t.Ext
+}
+
+// ImageRule 图片地址的改写规则
+// Match 判断规则是否适用于该主机；Rewrite 由原始地址得到下载地址与保存位置，
+// raw 为去除空白、补全协议后的原始地址，target 为默认的结果，可在其基础上修改，
+// 返回 ErrInvalidImage 表示该地址不是有效的图片
+type ImageRule struct {
+	Name    string
+	Match   func(host string) bool
+	Rewrite func(link *url.URL, raw string, target *ImageTarget) error
+}
+
+var imageRules = make([]ImageRule, 0)
+var irm = &sync.Mutex{}
+
+// RegisterImageRule 注册图片地址的改写规则，后注册的规则优先，每个地址只使用一条规则
+func RegisterImageRule(rule ImageRule) {
+	irm.Lock()
+	defer irm.Unlock()
+	imageRules = append(imageRules, rule)
+}
+
+// GetImageRule 取得适用于 host 的规则，没有时返回 false
+func GetImageRule(host string) (ImageRule, bool) {
+	irm.Lock()
+	defer irm.Unlock()
+	for i := len(imageRules) - 1; i >= 0; i-- {
+		if imageRules[i].Match(host) {
+			return imageRules[i], true
+		}
+	}
+	return ImageRule{}, false
+}
+
+// HostContains 主机名包含 s 时匹配
+func HostContains(s string) func(host string) bool {
+	return func(host string) bool {
+		return strings.Contains(host, s)
+	}
+}
+
+// ResolveImage 解析图片地址，按注册的规则得到下载地址与保存位置
+func ResolveImage(imgURL string) (ImageTarget, error) {
+	imgURL = strings.Trim(imgURL, " ")
+	if strings.HasPrefix(imgURL, "//") {
+		imgURL = "http:" + imgURL
+	}
+	var err error
+	var link *url.URL
+	if link, err = url.Parse(imgURL); err != nil {
+		return ImageTarget{}, err
+	}
+	if !strings.Contains(link.Scheme, "http") {
+		return ImageTarget{}, ErrNotScheme
+	}
+	ext := path.Ext(link.Path)
+	target := ImageTarget{URL: imgURL, Path: strings.TrimSuffix(link.Path, ext), Ext: ext}
+	if rule, ok := GetImageRule(link.Host); ok {
+		if err = rule.Rewrite(link, imgURL, &target); err != nil {
+			return ImageTarget{}, err
+		}
+	}
+	// 保存路径可能来自远程的链接，需要规范化，避免写到 ImgRootPath 以外
+	var p string
+	if p, err = SafePath(target.StorePath()); err != nil {
+		return ImageTarget{}, err
+	}
+	if p == "/" {
+		return ImageTarget{}, ErrNotFile
+	}
+	target.setStorePath(p)
+	return target, nil
+}
+
+// setStorePath 以带扩展名的路径设置 Path 与 Ext
+func (t *ImageTarget) setStorePath(p string) {
+	t.Ext = path.Ext(p)
+	t.Path = strings.TrimSuffix(p, t.Ext)
+}
+
+// trimQueryFrom 去掉下载地址中 marker 及之后的部分，用于去除 CDN 的缩放、裁剪参数
+func trimQueryFrom(marker string) func(*url.URL, string, *ImageTarget) error {
+	return func(_ *url.URL, raw string, target *ImageTarget) error {
+		target.URL = strings.SplitN(raw, marker, 2)[0]
+		return nil
+	}
+}
+
+// hashedPath 以原始地址的 md5 作为文件名，保存在 dir 下
+func hashedPath(dir, raw, ext string) ImageTarget {
+	return ImageTarget{URL: raw, Path: "/" + dir + "/" + cgghui.MD5(raw), Ext: "." + ext}
+}
+
+func init() {
+	RegisterImageRule(ImageRule{
+		Name:    "aliyuncs",
+		Match:   HostContains(".aliyuncs.com"),
+		Rewrite: trimQueryFrom("?x-oss-process"),
+	})
+	RegisterImageRule(ImageRule{
+		Name:    "jianshu",
+		Match:   func(host string) bool { return host == "upload-images.jianshu.io" },
+		Rewrite: trimQueryFrom("?imageMogr2"),
+	})
+	RegisterImageRule(ImageRule{
+		Name:  "toutiaoimg",
+		Match: HostContains(".toutiaoimg.com"),
+		Rewrite: func(link *url.URL, _ string, target *ImageTarget) error {
+			target.Path, target.Ext = strings.SplitN(link.Path, "~", 2)[0], ".jpg"
+			return nil
+		},
+	})
+	RegisterImageRule(ImageRule{
+		Name:  "toutiao",
+		Match: HostContains(".toutiao.com"),
+		Rewrite: func(link *url.URL, _ string, _ *ImageTarget) error {
+			if link.Path == "/mp/agw/article_material/open_image/get" {
+				return ErrInvalidImage
+			}
+			return nil
+		},
+	})
+	RegisterImageRule(ImageRule{
+		Name:  "byteimg",
+		Match: HostContains(".byteimg.com"),
+		Rewrite: func(link *url.URL, _ string, target *ImageTarget) error {
+			target.Path = strings.NewReplacer("~", "_", ":", "_").Replace(link.Path)
+			target.Ext = ".jpg"
+			return nil
+		},
+	})
+	RegisterImageRule(ImageRule{
+		Name:  "ws126net",
+		Match: HostContains(".ws.126.net"),
+		Rewrite: func(link *url.URL, raw string, target *ImageTarget) error {
+			if q := link.Query(); q.Has("type") {
+				*target = hashedPath("ws126net", raw, q.Get("type"))
+			}
+			return nil
+		},
+	})
+	RegisterImageRule(ImageRule{
+		Name:  "gtimg",
+		Match: HostContains("inews.gtimg.com"),
+		Rewrite: func(_ *url.URL, raw string, target *ImageTarget) error {
+			*target = hashedPath("inews_gtimg_com", raw, "jpg")
+			return nil
+		},
+	})
+	RegisterImageRule(ImageRule{
+		Name:  "qpic",
+		Match: HostContains(".qpic.cn"),
+		Rewrite: func(link *url.URL, raw string, target *ImageTarget) error {
+			ext := "jpg"
+			if q := link.Query(); q.Has("wx_fmt") {
+				ext = q.Get("wx_fmt")
+			}
+			*target = hashedPath("qpic_cn", raw, ext)
+			return nil
+		},
+	})
+	RegisterImageRule(ImageRule{
+		Name:  "meipian",
+		Match: HostContains(".meipian.me"),
+		Rewrite: func(link *url.URL, _ string, target *ImageTarget) error {
+			target.setStorePath(strings.SplitN(link.Path, "-mobile", 2)[0])
+			return nil
+		},
+	})
+}
@@ -0,0 +1,83 @@
+package collect
+
+import (
+	"errors"
+	"github.com/cgghui/cgghui"
+	"net/url"
+	"testing"
+)
+
+func TestResolveImage(t *testing.T) {
+	const (
+		ws126 = "https://nimg.ws.126.net/?url=http%3A%2F%2Fcms-bucket.ws.126.net%2Fa.jpg&type=webp"
+		gtimg = "https://inews.gtimg.com/newsapp_bt/0/14851/641"
+		qpic  = "https://mmbiz.qpic.cn/mmbiz_png/abc/640?wx_fmt=png"
+		qpic2 = "https://mmbiz.qpic.cn/mmbiz_jpg/abc/640"
+	)
+	cases := []struct {
+		name, in  string
+		url, path string
+		err       error
+	}{
+		{"default", " //img.example.com/a/b.png ", "http://img.example.com/a/b.png", "/a/b.png", nil},
+		{"aliyuncs", "https://a.oss-cn-hangzhou.aliyuncs.com/x/y.png?x-oss-process=image/resize,w_100",
+			"https://a.oss-cn-hangzhou.aliyuncs.com/x/y.png", "/x/y.png", nil},
+		{"jianshu", "https://upload-images.jianshu.io/upload_images/1-2.jpg?imageMogr2/auto-orient/strip",
+			"https://upload-images.jianshu.io/upload_images/1-2.jpg", "/upload_images/1-2.jpg", nil},
+		{"toutiaoimg", "https://p3-tt.toutiaoimg.com/origin/pgc-image/abc~tplv-obj.image",
+			"https://p3-tt.toutiaoimg.com/origin/pgc-image/abc~tplv-obj.image", "/origin/pgc-image/abc.jpg", nil},
+		{"toutiao", "https://mp.toutiao.com/mp/agw/article_material/open_image/get?code=x", "", "", ErrInvalidImage},
+		{"byteimg", "https://p6-tt.byteimg.com/tos-cn-i-0004/abc~tplv-obj:1200:800.image",
+			"https://p6-tt.byteimg.com/tos-cn-i-0004/abc~tplv-obj:1200:800.image", "/tos-cn-i-0004/abc_tplv-obj_1200_800.image.jpg", nil},
+		{"ws126net", ws126, ws126, "/ws126net/" + cgghui.MD5(ws126) + ".webp", nil},
+		{"ws126net without type", "https://cms-bucket.ws.126.net/2022/0401/abc.png",
+			"https://cms-bucket.ws.126.net/2022/0401/abc.png", "/2022/0401/abc.png", nil},
+		{"gtimg", gtimg, gtimg, "/inews_gtimg_com/" + cgghui.MD5(gtimg) + ".jpg", nil},
+		{"qpic", qpic, qpic, "/qpic_cn/" + cgghui.MD5(qpic) + ".png", nil},
+		{"qpic without wx_fmt", qpic2, qpic2, "/qpic_cn/" + cgghui.MD5(qpic2) + ".jpg", nil},
+		{"meipian", "https://static2.meipian.me/users/1/abc.jpg-mobile",
+			"https://static2.meipian.me/users/1/abc.jpg-mobile", "/users/1/abc.jpg", nil},
+		{"not scheme", "ftp://img.example.com/a.png", "", "", ErrNotScheme},
+		{"not file", "https://img.example.com/", "", "", ErrNotFile},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			target, err := ResolveImage(c.in)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("error=%v, want %v", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error:%v", err)
+			}
+			if target.URL != c.url || target.StorePath() != c.path {
+				t.Fatalf("got %q %q, want %q %q", target.URL, target.StorePath(), c.url, c.path)
+			}
+		})
+	}
+}
+
+func TestRegisterImageRule(t *testing.T) {
+	RegisterImageRule(ImageRule{
+		Name:  "rule_test",
+		Match: HostContains(".qpic.cn"),
+		Rewrite: func(link *url.URL, raw string, target *ImageTarget) error {
+			target.Path, target.Ext = "/override"+link.Path, ".gif"
+			return nil
+		},
+	})
+	defer func() {
+		irm.Lock()
+		imageRules = imageRules[:len(imageRules)-1]
+		irm.Unlock()
+	}()
+	target, err := ResolveImage("https://mmbiz.qpic.cn/a/640")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if target.StorePath() != "/override/a/640.gif" {
+		t.Fatalf("store path=%q, later rule should take precedence", target.StorePath())
+	}
+}
@@ -0,0 +1,142 @@
+package collect
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ImageContentAddressed 图片是否按内容保存，默认关闭，由 crawl 的 --hash-images 开启
+// 为 true 时图片保存为 <ImgRootPath><ImageHashDir>/<sha256[:2]>/<sha256>.<ext>，相同的图片只保存一份，扩展名按图片的实际格式；
+// 为 false 时按 ImageRule 给出的路径保存，与旧版本一致。
+// 已有的图片目录开启后，旧文件保留在原路径，已发布的文章仍引用旧路径；之后采集的文章引用 /img/ 下的路径，
+// 同一地址的图片会再下载一次并记入索引，旧文件确认不再引用后可以删除
+var ImageContentAddressed = false
+
+// ImageHashDir 按内容保存的图片所在的目录，也是图片公开路径的前缀
+const ImageHashDir = "/img"
+
+// ImageIndexName 图片索引的文件名，位于 ImgRootPath 下
+const ImageIndexName = "index.jsonl"
+
+// ImageIndexEntry 一张图片的索引
+type ImageIndexEntry struct {
+	URL    string    `json:"url"`    // 下载地址，ImageRule 改写后的
+	Path   string    `json:"path"`   // 相对 ImgRootPath 的保存路径，也是公开路径
+	SHA256 string    `json:"sha256"` // 图片内容的 SHA-256
+	Time   time.Time `json:"time"`   // 下载时间
+}
+
+// ImageIndex 图片下载地址到内容的索引
+// 索引以 JSON Lines 追加写入文件，打开时按顺序回放，同一地址以最后一行为准
+type ImageIndex struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]ImageIndexEntry
+}
+
+// OpenImageIndex 打开索引文件，不存在时在第一次写入时创建；path 为空时只保存在内存中
+func OpenImageIndex(path string) (*ImageIndex, error) {
+	x := &ImageIndex{path: path, entries: make(map[string]ImageIndexEntry)}
+	if path == "" {
+		return x, nil
+	}
+	fp, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		var e ImageIndexEntry
+		// 写了一半的最后一行直接忽略
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.URL == "" {
+			continue
+		}
+		x.entries[e.URL] = e
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Lookup 按下载地址查找图片
+func (x *ImageIndex) Lookup(imgURL string) (ImageIndexEntry, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	e, ok := x.entries[imgURL]
+	return e, ok
+}
+
+// Put 记录图片，同一地址已有相同记录时不重复写入
+func (x *ImageIndex) Put(e ImageIndexEntry) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if old, ok := x.entries[e.URL]; ok && old.Path == e.Path {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	x.entries[e.URL] = e
+	if x.path == "" {
+		return nil
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(x.path), 0755); err != nil {
+		return err
+	}
+	fp, err := os.OpenFile(x.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = fp.Write(append(raw, '\n')); err != nil {
+		_ = fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// Len 索引中的图片数
+func (x *ImageIndex) Len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.entries)
+}
+
+var imageIndexes = make(map[string]*ImageIndex)
+var iim = &sync.Mutex{}
+
+// GetImageIndex 当前 ImgRootPath 的图片索引
+func GetImageIndex() (*ImageIndex, error) {
+	iim.Lock()
+	defer iim.Unlock()
+	root := ImgRootPath
+	if x, ok := imageIndexes[root]; ok {
+		return x, nil
+	}
+	x, err := OpenImageIndex(filepath.Join(root, ImageIndexName))
+	if err != nil {
+		return nil, err
+	}
+	imageIndexes[root] = x
+	return x, nil
+}
+
+// HashImagePath 内容为 sum 的图片相对 ImgRootPath 的保存路径
+func HashImagePath(sum, ext string) string {
+	return path.Join(ImageHashDir, sum[:2], sum+ext)
+}
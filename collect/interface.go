@@ -1,6 +1,9 @@
 package collect
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 var standardMap = make(map[string]func() Standard)
 var smm = &sync.Mutex{}
@@ -20,6 +23,16 @@ func GetStandard(name string) Standard {
 	return nil
 }
 
+// GetStandardContext 按名称取得支持 context 的采集器
+// 未实现 StandardContext 的旧采集器会通过 WithContext 适配
+func GetStandardContext(name string) StandardContext {
+	std := GetStandard(name)
+	if std == nil {
+		return nil
+	}
+	return WithContext(std)
+}
+
 func GetStandardName() []string {
 	smm.Lock()
 	defer smm.Unlock()
@@ -48,3 +61,57 @@ type Standard interface {
 	// 如果 art.Href 为空， 存在返回true 不存在返回false
 	HasSnapshot(art *Article) bool
 }
+
+// StandardContext 支持取消与超时的采集器
+type StandardContext interface {
+
+	// GetTag 获取标签列表
+	GetTag() []Tag
+
+	// ArticleListContext 同 ArticleList，ctx 取消或超时后应尽快返回 ctx.Err()
+	ArticleListContext(context.Context, Tag, int) ([]Article, error)
+
+	// ArticleDetailContext 同 ArticleDetail，ctx 取消或超时后应尽快返回 ctx.Err()
+	ArticleDetailContext(context.Context, *Article) error
+
+	// HasSnapshot 文章是否存在快照
+	HasSnapshot(art *Article) bool
+}
+
+// WithContext 将 Standard 适配为 StandardContext
+// 如果 std 已实现 StandardContext 则直接返回，否则只在调用前后检查 ctx，
+// 无法中断正在进行的请求，此时仍由 RequestTimeout 兜底
+func WithContext(std Standard) StandardContext {
+	if sc, ok := std.(StandardContext); ok {
+		return sc
+	}
+	return standardAdapter{std}
+}
+
+type standardAdapter struct {
+	Standard
+}
+
+func (a standardAdapter) ArticleListContext(ctx context.Context, tag Tag, page int) ([]Article, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	list, err := a.ArticleList(tag, page)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (a standardAdapter) ArticleDetailContext(ctx context.Context, art *Article) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := a.ArticleDetail(art); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
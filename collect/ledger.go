@@ -0,0 +1,272 @@
+package collect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LedgerPath 默认的采集记录文件
+const LedgerPath = "./ledger.jsonl"
+
+// LedgerEntry 一篇文章的采集记录
+type LedgerEntry struct {
+	Site          string    `json:"site"`
+	Href          string    `json:"href"`                     // 规范化后的链接，见 CanonicalHref
+	FirstSeen     time.Time `json:"first_seen"`               // 首次出现在列表中的时间
+	LastProcessed time.Time `json:"last_processed,omitempty"` // 最后一次成功采集详情的时间
+}
+
+// Ledger 已采集文章的记录，按 采集器名称 + 规范化链接 区分
+// 记录以 JSON Lines 追加写入文件，打开时按顺序回放，同一文章以最后一行为准
+type Ledger struct {
+	mu      sync.Mutex
+	path    string
+	fp      *os.File
+	entries map[string]*LedgerEntry
+}
+
+// OpenLedger 打开记录文件，不存在时创建；path 为空时只保存在内存中
+func OpenLedger(path string) (*Ledger, error) {
+	l := &Ledger{path: path, entries: make(map[string]*LedgerEntry)}
+	if path == "" {
+		return l, nil
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l.fp = fp
+	return l, nil
+}
+
+func (l *Ledger) load() error {
+	fp, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e LedgerEntry
+		// 写了一半的最后一行直接忽略
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Href == "" {
+			continue
+		}
+		l.entries[ledgerKey(e.Site, e.Href)] = &e
+	}
+	return scanner.Err()
+}
+
+func ledgerKey(site, href string) string {
+	return site + "\x00" + href
+}
+
+// CanonicalHref 规范化链接：去掉首尾空白与 #fragment，scheme 与 host 转为小写，
+// 移除 utm_ 开头的统计参数并对参数排序；无法解析的链接原样返回
+func CanonicalHref(href string) string {
+	href = strings.TrimSpace(href)
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			if strings.HasPrefix(strings.ToLower(k), "utm_") {
+				q.Del(k)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// Entry 取得文章的记录
+func (l *Ledger) Entry(site, href string) (LedgerEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[ledgerKey(site, CanonicalHref(href))]; ok {
+		return *e, true
+	}
+	return LedgerEntry{}, false
+}
+
+// Seen 文章是否出现过
+func (l *Ledger) Seen(site, href string) bool {
+	_, ok := l.Entry(site, href)
+	return ok
+}
+
+// Processed 文章的详情是否采集过
+func (l *Ledger) Processed(site, href string) bool {
+	e, ok := l.Entry(site, href)
+	return ok && !e.LastProcessed.IsZero()
+}
+
+// MarkSeen 记录文章出现在列表中，已记录过时返回 false
+func (l *Ledger) MarkSeen(site, href string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	href = CanonicalHref(href)
+	key := ledgerKey(site, href)
+	if _, ok := l.entries[key]; ok {
+		return false, nil
+	}
+	e := &LedgerEntry{Site: site, Href: href, FirstSeen: time.Now()}
+	l.entries[key] = e
+	return true, l.append(e)
+}
+
+// MarkProcessed 记录文章的详情已采集
+func (l *Ledger) MarkProcessed(site, href string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	href = CanonicalHref(href)
+	key := ledgerKey(site, href)
+	now := time.Now()
+	e, ok := l.entries[key]
+	if !ok {
+		e = &LedgerEntry{Site: site, Href: href, FirstSeen: now}
+		l.entries[key] = e
+	}
+	e.LastProcessed = now
+	return l.append(e)
+}
+
+func (l *Ledger) append(e *LedgerEntry) error {
+	if l.fp == nil {
+		return nil
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = l.fp.Write(append(raw, '\n'))
+	return err
+}
+
+// Entries 全部记录，按采集器名称与首次出现时间排序
+func (l *Ledger) Entries() []LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := make([]LedgerEntry, 0, len(l.entries))
+	for _, e := range l.entries {
+		r = append(r, *e)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Site != r[j].Site {
+			return r[i].Site < r[j].Site
+		}
+		if !r[i].FirstSeen.Equal(r[j].FirstSeen) {
+			return r[i].FirstSeen.Before(r[j].FirstSeen)
+		}
+		return r[i].Href < r[j].Href
+	})
+	return r
+}
+
+// Compact 用当前记录重写文件，去掉被覆盖的旧行
+func (l *Ledger) Compact() error {
+	entries := l.Entries()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fp == nil {
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+	if err := l.fp.Close(); err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(l.path, buf.Bytes()); err != nil {
+		return err
+	}
+	fp, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	l.fp = fp
+	return nil
+}
+
+// Close 关闭记录文件
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fp == nil {
+		return nil
+	}
+	err := l.fp.Close()
+	l.fp = nil
+	return err
+}
+
+// IncrementalList 增量获取 tag 的文章列表
+// 从第 1 页开始翻页，某页的文章全部在本次运行前出现过且都已采集成功、列表为空或达到 maxPages 时停止，
+// 上次运行中途失败时，见过但未采集成功的文章之后的页面仍会继续翻页；
+// 尚未成功采集详情的文章依次交给 fn，fn 返回错误时停止。采集成功后应由调用方调用 MarkProcessed
+func IncrementalList(ctx context.Context, std StandardContext, site string, ledger *Ledger, tag Tag, maxPages int, fn func(*Article) error) error {
+	for page := 1; maxPages <= 0 || page <= maxPages; page++ {
+		list, err := std.ArticleListContext(ctx, tag, page)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		fresh := 0
+		for i := range list {
+			var isNew bool
+			if isNew, err = ledger.MarkSeen(site, list[i].Href); err != nil {
+				return err
+			}
+			if isNew {
+				fresh++
+			}
+		}
+		pending := 0
+		for i := range list {
+			if ledger.Processed(site, list[i].Href) {
+				continue
+			}
+			pending++
+			if err = fn(&list[i]); err != nil {
+				return err
+			}
+		}
+		if fresh == 0 && pending == 0 {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package collect
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pagedStandard 每页固定返回 pages[page-1] 中的链接
+type pagedStandard struct {
+	pages [][]string
+	calls int
+}
+
+func (p *pagedStandard) GetTag() []Tag { return []Tag{TagCommerce} }
+
+func (p *pagedStandard) ArticleListContext(_ context.Context, _ Tag, page int) ([]Article, error) {
+	p.calls++
+	if page > len(p.pages) {
+		return nil, nil
+	}
+	r := make([]Article, 0)
+	for _, href := range p.pages[page-1] {
+		r = append(r, Article{Href: href})
+	}
+	return r, nil
+}
+
+func (p *pagedStandard) ArticleDetailContext(context.Context, *Article) error { return nil }
+
+func (p *pagedStandard) HasSnapshot(*Article) bool { return false }
+
+func TestCanonicalHref(t *testing.T) {
+	cases := map[string]string{
+		" HTTPS://Example.COM/a/1.html#top ":         "https://example.com/a/1.html",
+		"https://example.com/a?utm_source=x&b=2&a=1": "https://example.com/a?a=1&b=2",
+		"ebiz/202204/2001.html":                      "ebiz/202204/2001.html",
+		"532000001_121000001":                        "532000001_121000001",
+	}
+	for in, want := range cases {
+		if got := CanonicalHref(in); got != want {
+			t.Errorf("CanonicalHref(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLedgerIncremental(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.jsonl")
+	ledger, err := OpenLedger(path)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	std := &pagedStandard{pages: [][]string{{"/a/1", "/a/2"}, {"/a/3"}}}
+	processed := make([]string, 0)
+	handle := func(art *Article) error {
+		processed = append(processed, art.Href)
+		if art.Href == "/a/3" {
+			// 模拟详情采集失败，下次运行应重试
+			return nil
+		}
+		return ledger.MarkProcessed("site", art.Href)
+	}
+	if err = IncrementalList(context.Background(), std, "site", ledger, TagCommerce, 0, handle); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if len(processed) != 3 || std.calls != 3 {
+		t.Fatalf("processed=%v calls=%d", processed, std.calls)
+	}
+	if err = ledger.Close(); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+
+	// 重新打开后第 2 页的文章都已见过，但 /a/3 未完成，被重试并继续翻页，第 3 页的 /a/5 不会漏掉；
+	// 第 4 页的文章都已见过且已完成，翻到第 4 页即停止
+	if ledger, err = OpenLedger(path); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	defer func() {
+		_ = ledger.Close()
+	}()
+	if !ledger.Processed("site", "/a/1") || ledger.Processed("site", "/a/3") || !ledger.Seen("site", "/a/3") {
+		t.Fatalf("entries=%+v", ledger.Entries())
+	}
+	std.pages = [][]string{{"/a/4", "/a/1"}, {"/a/2", "/a/3"}, {"/a/5"}, {"/a/2"}, {"/a/6"}}
+	std.calls = 0
+	processed = processed[:0]
+	if err = IncrementalList(context.Background(), std, "site", ledger, TagCommerce, 0, handle); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if std.calls != 4 || strings.Join(processed, ",") != "/a/4,/a/3,/a/5" {
+		t.Fatalf("processed=%v calls=%d", processed, std.calls)
+	}
+	if err = ledger.Compact(); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if n := len(ledger.Entries()); n != 5 {
+		t.Fatalf("entries=%d", n)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = ledger.MarkSeen("site", "/b/"+strconv.Itoa(i)); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+	}
+	if n := len(ledger.Entries()); n != 8 {
+		t.Fatalf("entries=%d", n)
+	}
+}
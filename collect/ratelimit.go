@@ -0,0 +1,269 @@
+package collect
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetryAfter 429 响应未带 Retry-After 时的等待时间
+const DefaultRetryAfter = 30 * time.Second
+
+// RateLimit 对同一主机的请求限速
+type RateLimit struct {
+	Rate       float64       `json:"rate" yaml:"rate"`               // 每秒请求数，<= 0 为不限
+	Burst      int           `json:"burst" yaml:"burst"`             // 令牌桶容量，<= 0 时为 1
+	MinDelay   time.Duration `json:"min_delay" yaml:"min_delay"`     // 相邻两次请求的最小间隔
+	MaxRetry   int           `json:"max_retry" yaml:"max_retry"`     // 收到 429 后最多重试的次数
+	MaxBackoff time.Duration `json:"max_backoff" yaml:"max_backoff"` // Retry-After 的上限，<= 0 为不限
+}
+
+// Limiter 默认的限速器，HttpClient 与 DownloadClient 都经过它
+var Limiter = NewRateLimitTransport(http.DefaultTransport)
+
+// RequestTimeout HttpClient 每次请求的期限，从发出请求到读完响应，不含在 Limiter 中等待的时间
+// 不使用 http.Client.Timeout，因为它包括等待限速与 Retry-After 的时间，等待较长时请求会直接超时
+var RequestTimeout = 6 * time.Second
+
+// requestTimeout HttpClient 的 Transport：经过 Limiter，每次请求限时 RequestTimeout
+type requestTimeout struct{}
+
+func (requestTimeout) RoundTrip(req *http.Request) (*http.Response, error) {
+	return Limiter.RoundTripTimeout(req, RequestTimeout)
+}
+
+var siteHosts = make(map[string][]string)
+var shm = &sync.Mutex{}
+
+// RegisterRateLimit 为采集器设置限速，hosts 为该采集器访问的主机
+// 通常在采集器的 init 中与 RegisterStandard 一起调用
+func RegisterRateLimit(name string, limit RateLimit, hosts ...string) {
+	shm.Lock()
+	siteHosts[name] = append(siteHosts[name], hosts...)
+	hosts = siteHosts[name]
+	shm.Unlock()
+	for _, host := range hosts {
+		Limiter.SetLimit(host, limit)
+	}
+}
+
+// SetRateLimit 修改已注册采集器的限速，采集器未注册主机时返回 ErrUndefinedSite
+func SetRateLimit(name string, limit RateLimit) error {
+	shm.Lock()
+	hosts, ok := siteHosts[name]
+	shm.Unlock()
+	if !ok {
+		return ErrUndefinedSite
+	}
+	for _, host := range hosts {
+		Limiter.SetLimit(host, limit)
+	}
+	return nil
+}
+
+// RateLimitTransport 按主机限速的 http.RoundTripper
+// 每个主机一个令牌桶，并保证相邻请求的最小间隔；
+// 收到 429 时按 Retry-After 暂停该主机的全部请求，GET 与 HEAD 请求会在等待后重试；429 只在这一层重试，RetryPolicy 不重试 429
+type RateLimitTransport struct {
+	Base    http.RoundTripper
+	Default RateLimit // 未单独设置的主机使用的限速
+
+	mu     sync.Mutex
+	limits map[string]RateLimit
+	hosts  map[string]*bucket
+}
+
+func NewRateLimitTransport(base http.RoundTripper) *RateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RateLimitTransport{Base: base, limits: make(map[string]RateLimit), hosts: make(map[string]*bucket)}
+}
+
+// SetLimit 设置主机的限速，host 不含端口时匹配该主机的全部端口
+func (t *RateLimitTransport) SetLimit(host string, limit RateLimit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	host = strings.ToLower(host)
+	t.limits[host] = limit
+	if b, ok := t.hosts[host]; ok {
+		b.setLimit(limit)
+	}
+}
+
+func (t *RateLimitTransport) bucket(host string) *bucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	host = strings.ToLower(host)
+	if b, ok := t.hosts[host]; ok {
+		return b
+	}
+	limit, ok := t.limits[host]
+	if !ok {
+		if i := strings.LastIndexByte(host, ':'); i != -1 {
+			limit, ok = t.limits[host[:i]]
+		}
+	}
+	if !ok {
+		limit = t.Default
+	}
+	b := &bucket{}
+	b.setLimit(limit)
+	t.hosts[host] = b
+	return b
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.RoundTripTimeout(req, 0)
+}
+
+// RoundTripTimeout 同 RoundTrip，每次发出的请求限时 timeout，<= 0 为不限
+// 在令牌桶中等待与收到 429 后等待的时间不计入 timeout
+func (t *RateLimitTransport) RoundTripTimeout(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	b := t.bucket(req.URL.Host)
+	retryable := (req.Method == http.MethodGet || req.Method == http.MethodHead) && req.Body == nil
+	for attempt := 0; ; attempt++ {
+		if err := b.wait(req.Context()); err != nil {
+			return nil, err
+		}
+		resp, err := t.send(req, timeout)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+		limit := b.getLimit()
+		delay := RetryAfter(resp.Header.Get("Retry-After"), DefaultRetryAfter)
+		if limit.MaxBackoff > 0 && delay > limit.MaxBackoff {
+			delay = limit.MaxBackoff
+		}
+		b.block(delay)
+		if !retryable || attempt >= limit.MaxRetry {
+			return resp, nil
+		}
+		_ = resp.Body.Close()
+	}
+}
+
+// send 经 Base 发出请求，timeout 到期时中断请求与读取响应
+func (t *RateLimitTransport) send(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 {
+		return t.Base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := t.Base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody 关闭时释放请求的 context
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// RetryAfter 解析 Retry-After，支持秒数与 HTTP 日期，无法解析时返回 def
+func RetryAfter(value string, def time.Duration) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return def
+	}
+	if sec, err := strconv.Atoi(value); err == nil {
+		if sec < 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return def
+}
+
+// bucket 单个主机的令牌桶
+type bucket struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time // 上次补充令牌的时间
+	next   time.Time // 下一次请求最早的时间
+}
+
+func (b *bucket) setLimit(limit RateLimit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	b.limit = limit
+	b.tokens = float64(limit.Burst)
+	b.last = time.Now()
+}
+
+func (b *bucket) getLimit() RateLimit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limit
+}
+
+// block 在 d 之内暂停该主机的请求
+func (b *bucket) block(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until := time.Now().Add(d); until.After(b.next) {
+		b.next = until
+	}
+}
+
+// reserve 取得一个令牌，返回 0；令牌不足或未到间隔时返回需要等待的时间
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.next) {
+		return b.next.Sub(now)
+	}
+	if b.limit.Rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+		if max := float64(b.limit.Burst); b.tokens > max {
+			b.tokens = max
+		}
+		b.last = now
+		if b.tokens < 1 {
+			return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+		}
+		b.tokens--
+	}
+	b.next = now.Add(b.limit.MinDelay)
+	return 0
+}
+
+func (b *bucket) wait(ctx context.Context) error {
+	for {
+		d := b.reserve(time.Now())
+		if d <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
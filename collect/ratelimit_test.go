@@ -0,0 +1,117 @@
+package collect
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 2 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	transport := NewRateLimitTransport(nil)
+	transport.SetLimit(u.Hostname(), RateLimit{Rate: 100, Burst: 1, MinDelay: 50 * time.Millisecond, MaxRetry: 1})
+	client := &http.Client{Transport: transport}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("error:%v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d status %d", i, resp.StatusCode)
+		}
+	}
+	// 第 2 次请求收到 429，等待 Retry-After 后重试成功
+	if elapsed := time.Since(start); elapsed < time.Second || atomic.LoadInt32(&hits) != 4 {
+		t.Fatalf("elapsed=%v hits=%d", elapsed, hits)
+	}
+}
+
+func TestHttpClientRetryAfter(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(time.Second)
+			return
+		}
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	Limiter.SetLimit(u.Host, RateLimit{MaxRetry: 1})
+	timeout := RequestTimeout
+	RequestTimeout = 300 * time.Millisecond
+	defer func() {
+		RequestTimeout = timeout
+	}()
+	// Retry-After 比 RequestTimeout 长，等待后重试成功，而不是超时
+	start := time.Now()
+	resp, err := HttpClient.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	_ = resp.Body.Close()
+	if elapsed := time.Since(start); resp.StatusCode != http.StatusOK || elapsed < time.Second || atomic.LoadInt32(&hits) != 2 {
+		t.Fatalf("status=%d elapsed=%v hits=%d", resp.StatusCode, elapsed, hits)
+	}
+	// 请求本身仍然受 RequestTimeout 限制
+	if _, err = HttpClient.Get(srv.URL + "/slow"); err == nil || !IsRetryable(err) {
+		t.Fatalf("error:%v", err)
+	}
+}
+
+func TestRateLimitJSON(t *testing.T) {
+	var def SiteDefinition
+	raw := `{"name":"example","rate_limit":{"rate":1,"min_delay":"500ms","max_backoff":2000000000}}`
+	if err := json.Unmarshal([]byte(raw), &def); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if l := def.RateLimit; l == nil || l.Rate != 1 || l.MinDelay != 500*time.Millisecond || l.MaxBackoff != 2*time.Second {
+		t.Fatalf("rate_limit=%+v", l)
+	}
+	var policy RetryPolicy
+	if err := json.Unmarshal([]byte(`{"max_attempts":3,"base_delay":"1s","max_delay":"1m"}`), &policy); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if policy.MaxAttempts != 3 || policy.BaseDelay != time.Second || policy.MaxDelay != time.Minute {
+		t.Fatalf("policy=%+v", policy)
+	}
+	for _, bad := range []string{`{"min_delay":"soon"}`, `{"min_delay":true}`} {
+		var l RateLimit
+		if err := json.Unmarshal([]byte(bad), &l); err == nil {
+			t.Fatalf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d := RetryAfter("120", time.Second); d != 2*time.Minute {
+		t.Errorf("seconds: %v", d)
+	}
+	if d := RetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Second); d < 59*time.Minute {
+		t.Errorf("http date: %v", d)
+	}
+	if d := RetryAfter("soon", time.Second); d != time.Second {
+		t.Errorf("invalid: %v", d)
+	}
+}
@@ -0,0 +1,158 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy 抓取失败时的重试策略，重试间隔按指数增长并加入随机抖动
+type RetryPolicy struct {
+	MaxAttempts int           `json:"max_attempts" yaml:"max_attempts"` // 最多尝试的次数，含第一次，<= 1 时不重试
+	BaseDelay   time.Duration `json:"base_delay" yaml:"base_delay"`     // 第一次重试前的等待时间
+	MaxDelay    time.Duration `json:"max_delay" yaml:"max_delay"`       // 等待时间的上限
+	Jitter      float64       `json:"jitter" yaml:"jitter"`             // 抖动比例 0-1，等待时间在 [d*(1-Jitter), d] 之间
+}
+
+// DefaultRetryPolicy 默认的重试策略
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second, Jitter: 0.5}
+
+// Retry ArticleList、ArticleDetail 与 Download 使用的重试策略
+var Retry = DefaultRetryPolicy
+
+// FetchMaxRedirects Fetch 最多跟随的跳转次数，如 http 跳转到 https、补上末尾的 /
+var FetchMaxRedirects = 5
+
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// StatusError 非 2xx 的 HTTP 响应
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected status %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// RetryError 重试结束后返回的错误，记录尝试的次数
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (attempts: %d)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable 错误是否是暂时的，重试可能成功
+// 超时、连接被重置或拒绝、响应被截断，以及 408、502、503、504 视为暂时的；
+// 其它错误，如 404、ErrUndefinedTag、解析错误，视为永久的。
+// 429 由 Limiter 处理：暂停该主机 Retry-After 的时间并重试 RateLimit.MaxRetry 次，仍为 429 时不再由 RetryPolicy 重试，
+// 以免请求数成倍增加、两层的等待时间叠加
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		switch se.StatusCode {
+		case http.StatusRequestTimeout, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// Backoff 第 attempt 次重试前的等待时间，attempt 从 1 开始
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// Do 执行 fn，遇到暂时的错误时按策略重试
+// 失败时返回 *RetryError；ctx 取消或超时时立即返回 ctx.Err()
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= p.MaxAttempts || !IsRetryable(err) {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+		timer := time.NewTimer(p.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Fetch 以 HttpClient 请求 target 并读取全部内容，非 2xx 时返回 *StatusError，按 Retry 重试
+// 与 HttpClient 不同，最多跟随 FetchMaxRedirects 次跳转，超过时返回 ErrTooManyRedirects，不重试
+// spider 同 RequestStructure
+func Fetch(ctx context.Context, target string, spider ...bool) ([]byte, *http.Response, error) {
+	var body []byte
+	var resp *http.Response
+	client := *HttpClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > FetchMaxRedirects {
+			return fmt.Errorf("%w: %s", ErrTooManyRedirects, target)
+		}
+		return nil
+	}
+	err := Retry.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+		RequestStructure(req, spider...)
+		if resp, err = client.Do(req); err != nil {
+			return err
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return &StatusError{URL: target, StatusCode: resp.StatusCode}
+		}
+		body, err = io.ReadAll(resp.Body)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, resp, nil
+}
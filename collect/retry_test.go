@@ -0,0 +1,117 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchRetry(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if atomic.AddInt32(&hits, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		case "/down":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/old":
+			http.Redirect(w, r, "/new/", http.StatusMovedPermanently)
+		case "/new/":
+			_, _ = w.Write([]byte("new"))
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	retry := Retry
+	Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, Jitter: 0.5}
+	defer func() {
+		Retry = retry
+	}()
+
+	body, _, err := Fetch(context.Background(), srv.URL+"/flaky")
+	if err != nil || string(body) != "ok" || hits != 3 {
+		t.Fatalf("body=%q hits=%d error:%v", body, hits, err)
+	}
+
+	var re *RetryError
+	var se *StatusError
+	_, _, err = Fetch(context.Background(), srv.URL+"/missing")
+	if !errors.As(err, &re) || re.Attempts != 1 || !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Fatalf("error:%v", err)
+	}
+	_, _, err = Fetch(context.Background(), srv.URL+"/down")
+	if !errors.As(err, &re) || re.Attempts != 3 {
+		t.Fatalf("error:%v", err)
+	}
+
+	// 跟随跳转，跳转过多时不重试
+	if body, _, err = Fetch(context.Background(), srv.URL+"/old"); err != nil || string(body) != "new" {
+		t.Fatalf("body=%q error:%v", body, err)
+	}
+	_, _, err = Fetch(context.Background(), srv.URL+"/loop")
+	if !errors.Is(err, ErrTooManyRedirects) || !errors.As(err, &re) || re.Attempts != 1 {
+		t.Fatalf("error:%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err = Fetch(ctx, srv.URL+"/down"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error:%v", err)
+	}
+}
+
+func TestFetchTooManyRequests(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	Limiter.SetLimit(u.Host, RateLimit{MaxRetry: 2})
+	retry := Retry
+	Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	defer func() {
+		Retry = retry
+	}()
+	// 429 只由 Limiter 重试 MaxRetry 次，Retry 不再重试
+	var re *RetryError
+	var se *StatusError
+	_, _, err := Fetch(context.Background(), srv.URL)
+	if !errors.As(err, &re) || re.Attempts != 1 || !errors.As(err, &se) || se.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("error:%v", err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Fatalf("hits=%d, want 3", n)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := map[error]bool{
+		&StatusError{StatusCode: http.StatusGatewayTimeout}:  true,
+		&StatusError{StatusCode: http.StatusNotFound}:        false,
+		&StatusError{StatusCode: http.StatusTooManyRequests}: false,
+		ErrUndefinedTag:          false,
+		ErrArticleTooShort:       false,
+		context.DeadlineExceeded: true,
+		context.Canceled:         false,
+	}
+	for err, want := range cases {
+		if got := IsRetryable(err); got != want {
+			t.Errorf("IsRetryable(%v) = %v", err, got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package collect
+
+import (
+	"errors"
+	"github.com/cgghui/cgghui"
+	"path"
+	"strings"
+)
+
+var ErrUnsafePath = errors.New("unsafe path")
+
+// maxSegmentLen 路径中每一段的最大长度
+const maxSegmentLen = 128
+
+// SafePath 将来自远程的不可信路径规范化为以 / 开头的相对路径
+// 反斜杠视为分隔符，去掉空段与 . 段，.. 超出根目录时返回 ErrUnsafePath；
+// 每一段只保留字母、数字与 . _ -，以 . 开头的段（如 .htaccess）前加 _，
+// 有字符被替换或长度超过限制时在扩展名前加上原始内容的短哈希，避免不同的路径映射到同一文件。
+// 结果再次经过 SafePath 不会改变
+func SafePath(p string) (string, error) {
+	if strings.IndexByte(p, 0) != -1 {
+		return "", ErrUnsafePath
+	}
+	clean := path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	// 以 / 为根清理后 .. 不会越界，再按相对路径检查一次以识别越界的写法
+	if rel := path.Clean(strings.TrimLeft(strings.ReplaceAll(p, "\\", "/"), "/")); rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", ErrUnsafePath
+	}
+	if clean == "/" {
+		return clean, nil
+	}
+	segments := strings.Split(clean[1:], "/")
+	for i, seg := range segments {
+		segments[i] = safeSegment(seg)
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// safeSegment 规范化路径中的一段
+func safeSegment(seg string) string {
+	b := &strings.Builder{}
+	changed := false
+	for _, r := range seg {
+		if r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte('_')
+		changed = true
+	}
+	s := b.String()
+	if strings.HasPrefix(s, ".") {
+		s = "_" + s
+		changed = true
+	}
+	if !changed && len(s) <= maxSegmentLen {
+		return s
+	}
+	ext := path.Ext(s)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	name := strings.TrimSuffix(s, ext)
+	suffix := "-" + cgghui.MD5(seg)[:8]
+	if max := maxSegmentLen - len(suffix) - len(ext); len(name) > max {
+		name = name[:max]
+	}
+	return name + suffix + ext
+}
+
+// SafeJoin 将不可信的路径 p 经 SafePath 规范化后拼接到 root 下，结果不会超出 root
+func SafeJoin(root, p string) (string, error) {
+	clean, err := SafePath(p)
+	if err != nil {
+		return "", err
+	}
+	if clean == "/" {
+		return "", ErrNotFile
+	}
+	return strings.TrimRight(root, "/") + clean, nil
+}
@@ -0,0 +1,85 @@
+package collect
+
+import (
+	"errors"
+	"github.com/cgghui/cgghui"
+	"strings"
+	"testing"
+)
+
+func TestSafePath(t *testing.T) {
+	cases := map[string]string{
+		"/a/b.png":                     "/a/b.png",
+		"a//./b/../c.png":              "/a/c.png",
+		"\\a\\b.png":                   "/a/b.png",
+		"/":                            "/",
+		"/a/.htaccess":                 "/a/_-" + cgghui.MD5(".htaccess")[:8] + ".htaccess",
+		"/a/图片 1.png":                  "/a/___1-" + cgghui.MD5("图片 1.png")[:8] + ".png",
+		"/" + strings.Repeat("x", 200): "/" + strings.Repeat("x", 119) + "-" + cgghui.MD5(strings.Repeat("x", 200))[:8],
+	}
+	for in, want := range cases {
+		got, err := SafePath(in)
+		if err != nil || got != want {
+			t.Errorf("SafePath(%q) = %q, error:%v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"../etc/passwd", "/a/../../etc/passwd", "..\\..\\x.png", "/a/b\x00.png"} {
+		if got, err := SafePath(in); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("SafePath(%q) = %q, error:%v", in, got, err)
+		}
+	}
+}
+
+// checkSafe 校验 p 是 root 下安全的路径
+func checkSafe(t *testing.T, root, p string) {
+	t.Helper()
+	if !strings.HasPrefix(p, root+"/") {
+		t.Fatalf("%q escapes %q", p, root)
+	}
+	for _, seg := range strings.Split(strings.TrimPrefix(p, root+"/"), "/") {
+		if seg == "" || seg == "." || seg == ".." || strings.HasPrefix(seg, ".") || len(seg) > maxSegmentLen {
+			t.Fatalf("%q: bad segment %q", p, seg)
+		}
+		if strings.Trim(seg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-") != "" {
+			t.Fatalf("%q: bad characters in %q", p, seg)
+		}
+	}
+}
+
+func FuzzSafeJoin(f *testing.F) {
+	for _, seed := range []string{"/a/b.png", "../../etc/passwd", "a/./b/../../..", "\\..\\x", "/a/.user.ini", "/图片.jpg", "//x//y"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, p string) {
+		got, err := SafeJoin("/www/site", p)
+		if err != nil {
+			return
+		}
+		checkSafe(t, "/www/site", got)
+		// 已规范化的路径不再改变
+		if again, err := SafeJoin("/www/site", strings.TrimPrefix(got, "/www/site")); err != nil || again != got {
+			t.Fatalf("SafeJoin not idempotent: %q -> %q, error:%v", got, again, err)
+		}
+	})
+}
+
+func FuzzResolveImage(f *testing.F) {
+	for _, seed := range []string{
+		"https://img.example.com/a/b.png",
+		"https://img.example.com/a/%2e%2e/%2e%2e/etc/passwd",
+		"https://img.example.com/../../../etc/cron.d/x",
+		"https://nimg.ws.126.net/?url=x&type=../../../x",
+		"https://mmbiz.qpic.cn/a/640?wx_fmt=/../../x",
+		"https://p3-tt.toutiaoimg.com/..%5c..%5cx~tplv.image",
+		"//static2.meipian.me/users/..%2F..%2Fx.jpg-mobile",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, imgURL string) {
+		target, err := ResolveImage(imgURL)
+		if err != nil {
+			return
+		}
+		checkSafe(t, "./upload_temp", "./upload_temp"+target.StorePath())
+	})
+}
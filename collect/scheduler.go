@@ -0,0 +1,154 @@
+package collect
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// CrawlJob 采集任务：采集器 Site 的标签 Tag 的前 Pages 页
+type CrawlJob struct {
+	Site  string
+	Tag   Tag
+	Pages int
+}
+
+// CrawlResult 采集结果
+// 列表页失败时 Article 为 nil；详情失败时 Article 为列表中的文章，Err 为详情的错误
+type CrawlResult struct {
+	Site    string
+	Tag     Tag
+	Page    int
+	Article *Article
+	Err     error
+}
+
+// Scheduler 并发采集调度，列表页与文章详情共用同一组并发限制
+type Scheduler struct {
+	Concurrency     int  // 全部站点合计的最大并发数，<= 0 时为 1
+	SiteConcurrency int  // 每个站点的最大并发数，<= 0 时与 Concurrency 相同
+	Detail          bool // 是否采集文章详情
+}
+
+// AllJobs 全部已注册采集器的全部标签
+func AllJobs(pages int) []CrawlJob {
+	names := GetStandardName()
+	sort.Strings(names)
+	jobs := make([]CrawlJob, 0)
+	for _, name := range names {
+		std := GetStandard(name)
+		if std == nil {
+			continue
+		}
+		tags := std.GetTag()
+		sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+		for _, tag := range tags {
+			jobs = append(jobs, CrawlJob{Site: name, Tag: tag, Pages: pages})
+		}
+	}
+	return jobs
+}
+
+// semaphore 计数信号量
+type semaphore chan struct{}
+
+func (s semaphore) acquire(ctx context.Context) error {
+	// 两者同时就绪时 select 随机选择，先检查 ctx 保证取消后不再开始新的请求
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s semaphore) release() {
+	<-s
+}
+
+// Run 开始采集，结果通过返回的 channel 逐个送出，全部完成后 channel 关闭
+// 调用方必须读完 channel；ctx 取消后未开始的请求不再执行
+func (s *Scheduler) Run(ctx context.Context, jobs []CrawlJob) <-chan CrawlResult {
+	concurrency, siteConcurrency := s.Concurrency, s.SiteConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if siteConcurrency <= 0 || siteConcurrency > concurrency {
+		siteConcurrency = concurrency
+	}
+	global := make(semaphore, concurrency)
+	sites := make(map[string]semaphore)
+	standards := make(map[string]StandardContext)
+	for _, job := range jobs {
+		if _, ok := sites[job.Site]; !ok {
+			sites[job.Site] = make(semaphore, siteConcurrency)
+			standards[job.Site] = GetStandardContext(job.Site)
+		}
+	}
+	results := make(chan CrawlResult, concurrency)
+	wg := &sync.WaitGroup{}
+	// run 在站点与全局的并发限制内执行 fn，先占站点的名额，避免占着全局名额等待
+	run := func(site string, fn func()) bool {
+		if err := sites[site].acquire(ctx); err != nil {
+			return false
+		}
+		defer sites[site].release()
+		if err := global.acquire(ctx); err != nil {
+			return false
+		}
+		defer global.release()
+		fn()
+		return true
+	}
+	detail := func(std StandardContext, r CrawlResult) {
+		defer wg.Done()
+		if !run(r.Site, func() { r.Err = std.ArticleDetailContext(ctx, r.Article) }) {
+			return
+		}
+		results <- r
+	}
+	list := func(std StandardContext, job CrawlJob, page int) {
+		defer wg.Done()
+		var arts []Article
+		var err error
+		if !run(job.Site, func() { arts, err = std.ArticleListContext(ctx, job.Tag, page) }) {
+			return
+		}
+		if err != nil {
+			results <- CrawlResult{Site: job.Site, Tag: job.Tag, Page: page, Err: err}
+			return
+		}
+		for i := range arts {
+			r := CrawlResult{Site: job.Site, Tag: job.Tag, Page: page, Article: &arts[i]}
+			if !s.Detail {
+				results <- r
+				continue
+			}
+			wg.Add(1)
+			go detail(std, r)
+		}
+	}
+	for _, job := range jobs {
+		std := standards[job.Site]
+		if std == nil {
+			wg.Add(1)
+			go func(job CrawlJob) {
+				defer wg.Done()
+				results <- CrawlResult{Site: job.Site, Tag: job.Tag, Err: ErrUndefinedSite}
+			}(job)
+			continue
+		}
+		for page := 1; page <= job.Pages; page++ {
+			wg.Add(1)
+			go list(std, job, page)
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
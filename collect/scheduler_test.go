@@ -0,0 +1,146 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errBrokenDetail = errors.New("broken detail")
+
+// countingStandard 记录同时进行的请求数，第 2 页列表与链接 "bad" 的详情返回错误
+type countingStandard struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	global  *countingStandard // 全部站点共用的计数，为 nil 时不计
+}
+
+func (c *countingStandard) enter() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running++; c.running > c.peak {
+		c.peak = c.running
+	}
+}
+
+func (c *countingStandard) leave() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running--
+}
+
+func (c *countingStandard) work() func() {
+	c.enter()
+	c.global.enter()
+	time.Sleep(5 * time.Millisecond)
+	return func() {
+		c.leave()
+		c.global.leave()
+	}
+}
+
+func (c *countingStandard) GetTag() []Tag { return []Tag{TagCommerce, TagMobile} }
+
+func (c *countingStandard) ArticleList(tag Tag, page int) ([]Article, error) {
+	return c.ArticleListContext(context.Background(), tag, page)
+}
+
+func (c *countingStandard) ArticleDetail(art *Article) error {
+	return c.ArticleDetailContext(context.Background(), art)
+}
+
+func (c *countingStandard) HasSnapshot(*Article) bool { return false }
+
+func (c *countingStandard) ArticleListContext(_ context.Context, tag Tag, page int) ([]Article, error) {
+	defer c.work()()
+	if page == 2 {
+		return nil, ErrUndefinedTag
+	}
+	prefix := "/" + strconv.Itoa(int(tag)) + "/"
+	return []Article{{Href: prefix + "1"}, {Href: prefix + "2"}, {Href: "bad"}}, nil
+}
+
+func (c *countingStandard) ArticleDetailContext(_ context.Context, art *Article) error {
+	defer c.work()()
+	if art.Href == "bad" {
+		return errBrokenDetail
+	}
+	art.Content = "<p>" + art.Href + "</p>"
+	return nil
+}
+
+func TestSchedulerLimits(t *testing.T) {
+	global := &countingStandard{}
+	sites := map[string]*countingStandard{
+		"scheduler_a": {global: global},
+		"scheduler_b": {global: global},
+		"scheduler_c": {global: global},
+	}
+	jobs := make([]CrawlJob, 0)
+	for name, std := range sites {
+		std := std
+		RegisterStandard(name, func() Standard { return std })
+		for _, tag := range std.GetTag() {
+			jobs = append(jobs, CrawlJob{Site: name, Tag: tag, Pages: 2})
+		}
+	}
+	jobs = append(jobs, CrawlJob{Site: "scheduler_missing", Tag: TagCommerce, Pages: 1})
+	s := &Scheduler{Concurrency: 4, SiteConcurrency: 2, Detail: true}
+	var articles, listErrs, detailErrs, missing int
+	for r := range s.Run(context.Background(), jobs) {
+		switch {
+		case errors.Is(r.Err, ErrUndefinedSite):
+			missing++
+		case r.Article == nil:
+			if !errors.Is(r.Err, ErrUndefinedTag) || r.Page != 2 {
+				t.Errorf("%s %s page %d: unexpected error %v", r.Site, r.Tag, r.Page, r.Err)
+			}
+			listErrs++
+		case r.Err != nil:
+			if !errors.Is(r.Err, errBrokenDetail) || r.Article.Href != "bad" {
+				t.Errorf("%s %s: unexpected error %v", r.Site, r.Article.Href, r.Err)
+			}
+			detailErrs++
+		default:
+			if r.Article.Content == "" {
+				t.Errorf("%s %s: detail not fetched", r.Site, r.Article.Href)
+			}
+			articles++
+		}
+	}
+	// 3 个站点 × 2 个标签，每个标签第 1 页 3 篇文章、第 2 页失败
+	if articles != 12 || detailErrs != 6 || listErrs != 6 || missing != 1 {
+		t.Fatalf("articles=%d detailErrs=%d listErrs=%d missing=%d", articles, detailErrs, listErrs, missing)
+	}
+	for name, std := range sites {
+		if std.peak > 2 {
+			t.Errorf("%s: %d concurrent requests, limit 2", name, std.peak)
+		}
+	}
+	if global.peak > 4 {
+		t.Errorf("%d concurrent requests, limit 4", global.peak)
+	}
+	if global.peak < 2 {
+		t.Errorf("requests did not run concurrently")
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	RegisterStandard("scheduler_cancel", func() Standard { return &countingStandard{} })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := &Scheduler{Concurrency: 2, Detail: true}
+	for r := range s.Run(ctx, []CrawlJob{{Site: "scheduler_cancel", Tag: TagCommerce, Pages: 5}}) {
+		t.Errorf("unexpected result after cancel: %+v", r)
+	}
+}
@@ -0,0 +1,417 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidDefinition = errors.New("invalid site definition")
+
+// SiteDefinitionPath 启动时自动加载的站点定义目录
+const SiteDefinitionPath = "./sites"
+
+// SiteDefinition 基于 CSS 选择器的站点定义，可用 YAML 或 JSON 书写
+type SiteDefinition struct {
+	Name    string `json:"name" yaml:"name"`         // 采集器名称
+	HomeURL string `json:"home_url" yaml:"home_url"` // 首页，相对链接以此为基准
+	Spider  bool   `json:"spider" yaml:"spider"`     // 是否伪装成百度蜘蛛，见 RequestStructure
+
+	// RateLimit 对 HomeURL 所在主机的限速，为空时不限速
+	RateLimit *RateLimit `json:"rate_limit" yaml:"rate_limit"`
+
+	// Column 标签 -> 列表页链接模板，{page} 替换为页码
+	// 标签可写英文名或数字，见 ParseTag
+	Column map[string]string `json:"column" yaml:"column"`
+
+	// FirstPage 标签 -> 第一页的链接，用于第一页链接规则与其它页不同的站点
+	FirstPage map[string]string `json:"first_page" yaml:"first_page"`
+
+	List    ListDefinition    `json:"list" yaml:"list"`
+	Detail  DetailDefinition  `json:"detail" yaml:"detail"`
+	Image   ImageDefinition   `json:"image" yaml:"image"`
+	Tag     TagDefinition     `json:"tag" yaml:"tag"`
+	Cleanup CleanupDefinition `json:"cleanup" yaml:"cleanup"`
+}
+
+// Field 选择器与取值的属性，Attr 为空时取文本
+type Field struct {
+	Selector string `json:"selector" yaml:"selector"`
+	Attr     string `json:"attr" yaml:"attr"`
+}
+
+// Value 在 s 内按 Field 取值
+func (f Field) Value(s *goquery.Selection) string {
+	if f.Selector != "" {
+		s = s.Find(f.Selector).First()
+	}
+	if f.Attr != "" {
+		return strings.TrimSpace(s.AttrOr(f.Attr, ""))
+	}
+	return strings.TrimSpace(s.Text())
+}
+
+// ListDefinition 列表页
+type ListDefinition struct {
+	Item  string `json:"item" yaml:"item"` // 每篇文章的容器
+	Title Field  `json:"title" yaml:"title"`
+	Href  Field  `json:"href" yaml:"href"`
+}
+
+// DetailDefinition 详情页
+type DetailDefinition struct {
+	Title       Field    `json:"title" yaml:"title"`
+	Time        Field    `json:"time" yaml:"time"`
+	TimeLayouts []string `json:"time_layouts" yaml:"time_layouts"` // 依次尝试，默认 RFC3339
+	Content     string   `json:"content" yaml:"content"`           // 正文容器
+	MinLength   int      `json:"min_length" yaml:"min_length"`     // 正文文本的最小字节数，不足时返回 ErrArticleTooShort
+}
+
+// ImageDefinition 正文中的图片
+type ImageDefinition struct {
+	Selector    string   `json:"selector" yaml:"selector"`         // 默认 img
+	Attrs       []string `json:"attrs" yaml:"attrs"`               // 依次尝试的图片链接属性，默认 src
+	RemoveAttrs []string `json:"remove_attrs" yaml:"remove_attrs"` // 下载后移除的属性
+}
+
+// TagDefinition 正文中的标签链接
+type TagDefinition struct {
+	Selector string `json:"selector" yaml:"selector"`
+	Prefix   string `json:"prefix" yaml:"prefix"` // 链接中 Prefix 之后的部分作为 ArticleTag.Tag，如：/tag/
+}
+
+// CleanupDefinition 正文清理规则
+type CleanupDefinition struct {
+	Remove      []string `json:"remove" yaml:"remove"`             // 移除匹配的元素
+	RemoveLast  []string `json:"remove_last" yaml:"remove_last"`   // 移除最后一个匹配的元素
+	RemoveAttrs []string `json:"remove_attrs" yaml:"remove_attrs"` // 移除全部元素上的属性
+	UnwrapLinks bool     `json:"unwrap_links" yaml:"unwrap_links"` // 去掉标签以外的 <a>，保留文字
+	Replace     []string `json:"replace" yaml:"replace"`           // 从正文中删除的文字
+}
+
+// LoadSiteDefinition 读取站点定义，按扩展名识别 .json .yaml .yml
+func LoadSiteDefinition(name string) (*SiteDefinition, error) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	def := &SiteDefinition{}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		err = json.Unmarshal(raw, def)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, def)
+	default:
+		return nil, fmt.Errorf("%w: %s: unknown extension", ErrInvalidDefinition, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidDefinition, name, err)
+	}
+	if err = def.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return def, nil
+}
+
+func (d *SiteDefinition) validate() error {
+	if d.Name == "" || d.HomeURL == "" {
+		return fmt.Errorf("%w: name and home_url are required", ErrInvalidDefinition)
+	}
+	if d.List.Item == "" || d.Detail.Content == "" {
+		return fmt.Errorf("%w: list.item and detail.content are required", ErrInvalidDefinition)
+	}
+	for name := range d.Column {
+		if _, err := ParseTag(name); err != nil {
+			return fmt.Errorf("%w: column %q: %v", ErrInvalidDefinition, name, err)
+		}
+	}
+	for name := range d.FirstPage {
+		if _, err := ParseTag(name); err != nil {
+			return fmt.Errorf("%w: first_page %q: %v", ErrInvalidDefinition, name, err)
+		}
+	}
+	return nil
+}
+
+// LoadSiteDefinitions 加载 dir 下的全部站点定义并注册，返回注册的名称
+func LoadSiteDefinitions(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+		var def *SiteDefinition
+		if def, err = LoadSiteDefinition(filepath.Join(dir, entry.Name())); err != nil {
+			return names, err
+		}
+		RegisterSiteDefinition(def)
+		names = append(names, def.Name)
+	}
+	return names, nil
+}
+
+// RegisterSiteDefinition 以 def.Name 注册站点定义
+func RegisterSiteDefinition(def *SiteDefinition) {
+	RegisterStandard(def.Name, func() Standard {
+		return NewSelectorStandard(def)
+	})
+	if def.RateLimit != nil {
+		if u, err := url.Parse(def.HomeURL); err == nil {
+			RegisterRateLimit(def.Name, *def.RateLimit, u.Host)
+		}
+	}
+}
+
+// SelectorStandard 由 SiteDefinition 驱动的通用采集器
+type SelectorStandard struct {
+	Def      *SiteDefinition
+	Snapshot SnapshotStore // 为 nil 时使用 Snapshot
+	column   map[Tag]string
+	first    map[Tag]string
+}
+
+func NewSelectorStandard(def *SiteDefinition) *SelectorStandard {
+	s := &SelectorStandard{Def: def, column: make(map[Tag]string), first: make(map[Tag]string)}
+	for name, tpl := range def.Column {
+		if tag, err := ParseTag(name); err == nil {
+			s.column[tag] = tpl
+		}
+	}
+	for name, link := range def.FirstPage {
+		if tag, err := ParseTag(name); err == nil {
+			s.first[tag] = link
+		}
+	}
+	return s
+}
+
+func (s *SelectorStandard) GetTag() []Tag {
+	r := make([]Tag, 0, len(s.column))
+	for k := range s.column {
+		r = append(r, k)
+	}
+	return r
+}
+
+// resolve 将相对链接转为基于 HomeURL 的完整链接
+func (s *SelectorStandard) resolve(ref string) string {
+	base, err := url.Parse(s.Def.HomeURL)
+	if err != nil {
+		return ref
+	}
+	var u *url.URL
+	if u, err = url.Parse(ref); err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+func (s *SelectorStandard) ArticleList(tag Tag, page int) ([]Article, error) {
+	return s.ArticleListContext(context.Background(), tag, page)
+}
+
+func (s *SelectorStandard) ArticleListContext(ctx context.Context, tag Tag, page int) ([]Article, error) {
+	tpl, ok := s.column[tag]
+	if !ok {
+		return nil, ErrUndefinedTag
+	}
+	if first, ok := s.first[tag]; ok && page <= 1 {
+		tpl = first
+	}
+	target := s.resolve(strings.ReplaceAll(tpl, "{page}", strconv.Itoa(page)))
+	body, _, err := Fetch(ctx, target, s.Def.Spider)
+	if err != nil {
+		return nil, err
+	}
+	var doc *goquery.Document
+	if doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body)); err != nil {
+		return nil, err
+	}
+	href := s.Def.List.Href
+	if href.Attr == "" {
+		href.Attr = "href"
+	}
+	articles := make([]Article, 0)
+	doc.Find(s.Def.List.Item).Each(func(_ int, item *goquery.Selection) {
+		link := href.Value(item)
+		if link == "" {
+			return
+		}
+		articles = append(articles, Article{
+			Title: s.Def.List.Title.Value(item),
+			Href:  s.resolve(link),
+		})
+	})
+	return articles, nil
+}
+
+func (s *SelectorStandard) HasSnapshot(art *Article) bool {
+	if art.Href == "" {
+		return false
+	}
+	return HasSnapshot(s.Snapshot, s.Def.Name, s.resolve(art.Href))
+}
+
+func (s *SelectorStandard) ArticleDetail(art *Article) error {
+	return s.ArticleDetailContext(context.Background(), art)
+}
+
+func (s *SelectorStandard) ArticleDetailContext(ctx context.Context, art *Article) error {
+	var err error
+	if art.Href == "" {
+		return ErrUndefinedArticleHref
+	}
+	var body []byte
+	if body, err = FetchSnapshot(ctx, s.Snapshot, s.Def.Name, s.resolve(art.Href), s.Def.Spider); err != nil {
+		return err
+	}
+	var doc *goquery.Document
+	if doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body)); err != nil {
+		return err
+	}
+	def := s.Def.Detail
+	if title := def.Title.Value(doc.Selection); title != "" {
+		art.Title = title
+	}
+	art.PostTime = s.parseTime(def.Time.Value(doc.Selection))
+	if art.LocalImages == nil {
+		art.LocalImages = make([]string, 0)
+	}
+	if art.Images == nil {
+		art.Images = make([]ImageRecord, 0)
+	}
+	if art.Tag == nil {
+		art.Tag = make([]ArticleTag, 0)
+	}
+	word := doc.Find(def.Content).First()
+	cleanup := s.Def.Cleanup
+	for _, sel := range cleanup.Remove {
+		word.Find(sel).Remove()
+	}
+	for _, sel := range cleanup.RemoveLast {
+		word.Find(sel).Last().Remove()
+	}
+	// 处理图片
+	img := s.Def.Image
+	imgSelector, imgAttrs := img.Selector, img.Attrs
+	if imgSelector == "" {
+		imgSelector = "img"
+	}
+	if len(imgAttrs) == 0 {
+		imgAttrs = []string{"src"}
+	}
+	src := func(el *goquery.Selection) string {
+		for _, attr := range imgAttrs {
+			if src := strings.TrimSpace(el.AttrOr(attr, "")); src != "" {
+				return s.resolve(src)
+			}
+		}
+		return ""
+	}
+	var ie *ImagesError
+	err = DownloadImages(ctx, art, word.Find(imgSelector), src, func(el *goquery.Selection, rec ImageRecord) {
+		if rec.Status != ImageOK {
+			el.Remove()
+			return
+		}
+		if alt := el.AttrOr("alt", ""); len(alt) == 0 || strings.Contains(alt, "http://") {
+			el.RemoveAttr("alt")
+		}
+		for _, attr := range imgAttrs {
+			el.RemoveAttr(attr)
+		}
+		for _, attr := range img.RemoveAttrs {
+			el.RemoveAttr(attr)
+		}
+		el.SetAttr("src", rec.Path)
+		SetSrcset(el, rec)
+	})
+	// 下载失败的图片已记录在 art.Images 中，不影响文章的采集
+	if err != nil && !errors.As(err, &ie) {
+		return err
+	}
+	ogImage := strings.TrimSpace(doc.Find(`meta[property="og:image"]`).AttrOr("content", ""))
+	if ogImage != "" {
+		ogImage = s.resolve(ogImage)
+	}
+	SelectCover(ctx, art, ogImage)
+	// 处理标签
+	if s.Def.Tag.Selector != "" {
+		word.Find(s.Def.Tag.Selector).Each(func(_ int, a *goquery.Selection) {
+			tag := a.AttrOr("href", "")
+			if prefix := s.Def.Tag.Prefix; prefix != "" && strings.Contains(tag, prefix) {
+				tag = strings.SplitN(tag, prefix, 2)[1]
+				tag = strings.TrimRight(tag, "/")
+			} else {
+				tag = ""
+			}
+			tg := ArticleTag{Name: strings.TrimSpace(a.Text()), Tag: strings.TrimSpace(tag)}
+			if tg.Name == "" {
+				return
+			}
+			art.Tag = append(art.Tag, tg)
+			a.RemoveAttr("href")
+			a.RemoveAttr("target")
+			a.RemoveAttr("title")
+			a.AddClass(TagClass[1:])
+			a.SetAttr(TagAttrName, tg.Name)
+			a.SetAttr(TagAttrValue, tg.Tag)
+		})
+	}
+	// 处理<a>
+	if cleanup.UnwrapLinks {
+		word.Find("a").Each(func(_ int, a *goquery.Selection) {
+			if _, ok := a.Attr(TagAttrName); ok {
+				return
+			}
+			aHTML, _ := a.Html()
+			a.BeforeHtml(aHTML)
+			a.Remove()
+		})
+	}
+	for _, attr := range cleanup.RemoveAttrs {
+		word.Find("[" + attr + "]").RemoveAttr(attr)
+	}
+	art.Content, _ = word.Html()
+	for _, text := range cleanup.Replace {
+		art.Content = strings.ReplaceAll(art.Content, text, "")
+	}
+	art.Content = strings.TrimSpace(art.Content)
+	if def.MinLength > 0 && len(strings.TrimSpace(word.Text())) < def.MinLength {
+		return ErrArticleTooShort
+	}
+	return nil
+}
+
+// parseTime 依次尝试 TimeLayouts，全部失败时使用当前时间
+func (s *SelectorStandard) parseTime(value string) time.Time {
+	layouts := s.Def.Detail.TimeLayouts
+	if len(layouts) == 0 {
+		layouts = []string{time.RFC3339}
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Local()
+		}
+	}
+	return time.Now()
+}
@@ -0,0 +1,85 @@
+package collect_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/collect/collecttest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectorStandard(t *testing.T) {
+	collecttest.Install(t, map[string]string{
+		"https://www.nbtimes.net/page/1?s=电商":                      "testdata/selector/list.html",
+		"https://www.nbtimes.net/yaowen/1001.html":                 "testdata/selector/detail_1001.html",
+		"https://www.nbtimes.net/wp-content/uploads/2022/04/a.png": "testdata/selector/img.png",
+	})
+	hashed := collect.ImageContentAddressed
+	collect.ImageContentAddressed = true
+	defer func() {
+		collect.ImageContentAddressed = hashed
+	}()
+	names, err := collect.LoadSiteDefinitions("testdata/selector")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if len(names) != 1 || names[0] != "example_nbtimes" {
+		t.Fatalf("names=%v", names)
+	}
+	obj := collect.GetStandard("example_nbtimes")
+	if len(obj.GetTag()) != 2 {
+		t.Fatalf("tags=%v", obj.GetTag())
+	}
+	if _, err = obj.ArticleList(collect.TagCar, 1); !errors.Is(err, collect.ErrUndefinedTag) {
+		t.Fatalf("error:%v", err)
+	}
+	list, err := obj.ArticleList(collect.TagCommerce, 1)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("article list == %d", len(list))
+	}
+	art := list[0]
+	if err = obj.ArticleDetail(&art); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if art.Title != "电商平台发布商家扶持新规" {
+		t.Errorf("title=%q", art.Title)
+	}
+	if art.PostTime.UTC().Format("2006-01-02 15:04") != "2022-04-20 02:30" {
+		t.Errorf("post time=%v", art.PostTime)
+	}
+	if len(art.Tag) != 1 || art.Tag[0] != (collect.ArticleTag{Name: "电商", Tag: "dianshang"}) {
+		t.Errorf("tag=%v", art.Tag)
+	}
+	raw, err := os.ReadFile("testdata/selector/img.png")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	sum := sha256.Sum256(raw)
+	img := collect.HashImagePath(hex.EncodeToString(sum[:]), ".png")
+	if len(art.LocalImages) != 1 || art.LocalImages[0] != img {
+		t.Errorf("local images=%v", art.LocalImages)
+	}
+	want := `<p>某电商平台今日发布商家扶持新规，覆盖流量、佣金与物流三个方面。</p>
+<div class="pgc-img"><img src="` + img + `"/></div>
+<p>详情可查看平台公告。</p>
+<p><span class="wpcom_tag_link"><a class="tag" data-name="电商" data-tag="dianshang">电商</a></span></p>`
+	if art.Content != want {
+		t.Errorf("content=%s", art.Content)
+	}
+}
+
+func TestLoadSiteDefinitionInvalid(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "bad.json")
+	if err := os.WriteFile(name, []byte(`{"name":"bad","home_url":"https://example.com/","column":{"nope":"x"}}`), 0644); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if _, err := collect.LoadSiteDefinition(name); !errors.Is(err, collect.ErrInvalidDefinition) {
+		t.Fatalf("error:%v", err)
+	}
+}
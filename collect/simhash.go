@@ -0,0 +1,221 @@
+package collect
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/PuerkitoBio/goquery"
+	"hash/fnv"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DuplicateIndexPath 默认的指纹索引文件
+const DuplicateIndexPath = "./simhash.jsonl"
+
+// DefaultSimilarity 默认的近似重复阈值，相当于 64 位指纹中最多 6 位不同
+const DefaultSimilarity = 0.9
+
+// shingleSize 计算指纹时每个片段的字数
+const shingleSize = 3
+
+// MinDuplicateTokens 参与近似重复检测的正文最少字数（字母与数字），
+// 正文只有图片或过短时指纹没有区分度，这样的文章不检测也不加入索引。小于 1 时按 1 处理，空正文始终不检测
+var MinDuplicateTokens = 20
+
+// DuplicateMatch 近似重复的来源文章
+type DuplicateMatch struct {
+	Site       string  `json:"site"`
+	Href       string  `json:"href"`
+	Title      string  `json:"title"`
+	Similarity float64 `json:"similarity"` // 1 为完全相同
+}
+
+// ContentText 取得 HTML 正文的纯文本
+func ContentText(content string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return content
+	}
+	return doc.Text()
+}
+
+// tokens 去掉空白与标点后的字，转为小写
+func tokens(text string) []rune {
+	runes := make([]rune, 0, len(text))
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			runes = append(runes, unicode.ToLower(r))
+		}
+	}
+	return runes
+}
+
+// SimHash 计算文本的 64 位 SimHash 指纹
+// 去掉空白与标点后按 shingleSize 个字切片，中英文一视同仁
+func SimHash(text string) uint64 {
+	return simHash(tokens(text))
+}
+
+func simHash(runes []rune) uint64 {
+	if len(runes) == 0 {
+		return 0
+	}
+	var weight [64]int
+	h := fnv.New64a()
+	for i := 0; i+shingleSize <= len(runes) || i == 0; i++ {
+		end := i + shingleSize
+		if end > len(runes) {
+			end = len(runes)
+		}
+		h.Reset()
+		_, _ = h.Write([]byte(string(runes[i:end])))
+		sum := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if sum&(1<<uint(b)) != 0 {
+				weight[b]++
+			} else {
+				weight[b]--
+			}
+		}
+	}
+	var fp uint64
+	for b := 0; b < 64; b++ {
+		if weight[b] > 0 {
+			fp |= 1 << uint(b)
+		}
+	}
+	return fp
+}
+
+// Similarity 两个指纹的相似度，1 为完全相同
+func Similarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// fingerprint 索引中的一篇文章
+type fingerprint struct {
+	Site  string `json:"site"`
+	Href  string `json:"href"`
+	Title string `json:"title"`
+	Hash  uint64 `json:"hash"`
+}
+
+// DuplicateIndex 跨站点的文章指纹索引
+// 记录以 JSON Lines 追加写入文件，与 Ledger 相同
+type DuplicateIndex struct {
+	mu        sync.Mutex
+	threshold float64
+	fp        *os.File
+	entries   []fingerprint
+	seen      map[string]bool
+}
+
+// OpenDuplicateIndex 打开指纹索引，path 为空时只保存在内存中
+// threshold 为判定近似重复的最低相似度，<= 0 时使用 DefaultSimilarity
+func OpenDuplicateIndex(path string, threshold float64) (*DuplicateIndex, error) {
+	if threshold <= 0 {
+		threshold = DefaultSimilarity
+	}
+	idx := &DuplicateIndex{threshold: threshold, entries: make([]fingerprint, 0), seen: make(map[string]bool)}
+	if path == "" {
+		return idx, nil
+	}
+	if fp, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(fp)
+		for scanner.Scan() {
+			var e fingerprint
+			// Hash 为 0 的是以前没有字数限制时加入的空正文
+			if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Href == "" || e.Hash == 0 {
+				continue
+			}
+			idx.add(e)
+		}
+		_ = fp.Close()
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	idx.fp = fp
+	return idx, nil
+}
+
+func (idx *DuplicateIndex) add(e fingerprint) {
+	key := ledgerKey(e.Site, e.Href)
+	if idx.seen[key] {
+		return
+	}
+	idx.seen[key] = true
+	idx.entries = append(idx.entries, e)
+}
+
+// Check 计算 art.Content 的指纹并在索引中查找最相似的其它文章
+// 相似度达到阈值时返回来源文章，否则将 art 加入索引并返回 nil；
+// 正文的字数少于 MinDuplicateTokens 时直接返回 nil，不加入索引
+func (idx *DuplicateIndex) Check(site string, art *Article) (*DuplicateMatch, error) {
+	runes := tokens(ContentText(art.Content))
+	if len(runes) < max(MinDuplicateTokens, 1) {
+		return nil, nil
+	}
+	e := fingerprint{Site: site, Href: CanonicalHref(art.Href), Title: art.Title, Hash: simHash(runes)}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	var best *DuplicateMatch
+	for _, other := range idx.entries {
+		if other.Site == e.Site && other.Href == e.Href {
+			continue
+		}
+		sim := Similarity(e.Hash, other.Hash)
+		if sim < idx.threshold || (best != nil && sim <= best.Similarity) {
+			continue
+		}
+		best = &DuplicateMatch{Site: other.Site, Href: other.Href, Title: other.Title, Similarity: sim}
+	}
+	if best != nil {
+		return best, nil
+	}
+	if idx.seen[ledgerKey(e.Site, e.Href)] {
+		return nil, nil
+	}
+	idx.add(e)
+	if idx.fp == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	_, err = idx.fp.Write(append(raw, '\n'))
+	return nil, err
+}
+
+// Len 索引中的文章数
+func (idx *DuplicateIndex) Len() int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return len(idx.entries)
+}
+
+// Close 关闭索引文件
+func (idx *DuplicateIndex) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.fp == nil {
+		return nil
+	}
+	err := idx.fp.Close()
+	idx.fp = nil
+	return err
+}
@@ -0,0 +1,79 @@
+package collect
+
+import (
+	"testing"
+)
+
+const pressRelease = `<p>4月20日，某电商平台宣布推出商家扶持计划，未来一年将投入百亿流量，帮助中小商家降低经营成本。</p>
+<p>平台方面表示，新入驻商家可享受三个月佣金减免，同时物流服务商将提供专属折扣，覆盖全国主要城市。</p>
+<p>业内人士认为，此举有望进一步激发市场活力，推动行业从价格竞争转向服务竞争。</p>`
+
+func TestDuplicateIndex(t *testing.T) {
+	idx, err := OpenDuplicateIndex("", 0)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	origin := Article{Href: "https://www.nbtimes.net/yaowen/1001.html", Title: "电商平台推出商家扶持计划", Content: pressRelease}
+	if match, _ := idx.Check("nbtimes_net", &origin); match != nil {
+		t.Fatalf("match=%+v", match)
+	}
+	// 换了标题、改了个别字的转载
+	copied := Article{
+		Href:  "532000001_121000001",
+		Title: "百亿流量扶持中小商家",
+		Content: `<p>4月20日，某电商平台宣布推出商家扶持计划，未来一年将投入百亿流量，帮助中小商家降低经营成本。</p>
+<p>平台表示，新入驻商家可享受三个月佣金减免，同时物流服务商将提供专属折扣，覆盖全国主要城市。</p>
+<p>业内人士认为，此举有望进一步激发市场活力，推动行业由价格竞争转向服务竞争。</p>`,
+	}
+	match, err := idx.Check("v2_sohu_com", &copied)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if match == nil || match.Site != "nbtimes_net" || match.Href != origin.Href {
+		t.Fatalf("match=%+v similarity=%.2f", match, Similarity(SimHash(ContentText(origin.Content)), SimHash(ContentText(copied.Content))))
+	}
+	other := Article{Href: "ebiz/202204/2001.html", Content: "<p>多家社区团购平台近期调整了补贴策略，业内人士认为零售行业的竞争将更加激烈。</p>"}
+	if match, _ = idx.Check("techsir_com", &other); match != nil {
+		t.Fatalf("match=%+v", match)
+	}
+	if idx.Len() != 2 {
+		t.Fatalf("len=%d", idx.Len())
+	}
+}
+
+func TestDuplicateIndexEmptyText(t *testing.T) {
+	idx, err := OpenDuplicateIndex("", 0)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	// 只有图片或过短的正文，指纹相同也不算重复
+	for i, content := range []string{
+		`<p><img src="/img/a.jpg"/></p>`,
+		`<p><img src="/img/b.jpg"/></p><p> </p>`,
+		`<figure><img src="/img/c.jpg"/><figcaption>图1</figcaption></figure>`,
+		`<figure><img src="/img/d.jpg"/><figcaption>图1</figcaption></figure>`,
+	} {
+		art := Article{Href: "https://www.nbtimes.net/gallery/" + string(rune('a'+i)) + ".html", Content: content}
+		if match, err := idx.Check("nbtimes_net", &art); match != nil || err != nil {
+			t.Fatalf("%d: match=%+v error:%v", i, match, err)
+		}
+	}
+	if idx.Len() != 0 {
+		t.Fatalf("len=%d", idx.Len())
+	}
+	// MinDuplicateTokens 为 0 时，空正文仍不检测
+	minTokens := MinDuplicateTokens
+	MinDuplicateTokens = 0
+	defer func() {
+		MinDuplicateTokens = minTokens
+	}()
+	for _, name := range []string{"e", "f"} {
+		art := Article{Href: "https://www.nbtimes.net/gallery/" + name + ".html", Content: `<p><img src="/img/e.jpg"/></p>`}
+		if match, err := idx.Check("nbtimes_net", &art); match != nil || err != nil {
+			t.Fatalf("%s: match=%+v error:%v", name, match, err)
+		}
+	}
+	if idx.Len() != 0 {
+		t.Fatalf("len=%d", idx.Len())
+	}
+}
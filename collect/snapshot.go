@@ -0,0 +1,240 @@
+package collect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/cgghui/cgghui"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+const SnapshotRootPath = "./snapshot"
+
+// Snapshot 默认的快照存储，采集器未指定存储时使用
+var Snapshot SnapshotStore = NewFileSnapshotStore(SnapshotRootPath, true)
+
+// SnapshotMeta 快照的元数据
+type SnapshotMeta struct {
+	URL         string    `json:"url"`          // 原始链接
+	StatusCode  int       `json:"status_code"`  // HTTP 状态码
+	ContentType string    `json:"content_type"` // Content-Type
+	FetchTime   time.Time `json:"fetch_time"`   // 抓取时间
+}
+
+// SnapshotStore 文章页面快照存储
+// site 为采集器名称，target 为页面的完整链接
+type SnapshotStore interface {
+
+	// Has 快照是否存在
+	Has(site, target string) bool
+
+	// Get 读取快照，不存在时返回 ErrSnapshotNotFound
+	Get(site, target string) ([]byte, SnapshotMeta, error)
+
+	// Put 保存快照，已存在时覆盖
+	Put(site, target string, body []byte, meta SnapshotMeta) error
+}
+
+// HasSnapshot 快照是否存在，store 为 nil 时使用 Snapshot
+func HasSnapshot(store SnapshotStore, site, target string) bool {
+	if store == nil {
+		store = Snapshot
+	}
+	return store.Has(site, target)
+}
+
+// FetchSnapshot 优先读取快照，快照不存在时通过 Fetch 请求 target 并保存
+// store 为 nil 时使用 Snapshot；spider 同 RequestStructure
+func FetchSnapshot(ctx context.Context, store SnapshotStore, site, target string, spider ...bool) ([]byte, error) {
+	if store == nil {
+		store = Snapshot
+	}
+	body, _, err := store.Get(site, target)
+	if err == nil {
+		return body, nil
+	}
+	if !errors.Is(err, ErrSnapshotNotFound) {
+		return nil, err
+	}
+	var resp *http.Response
+	if body, resp, err = Fetch(ctx, target, spider...); err != nil {
+		return nil, err
+	}
+	meta := SnapshotMeta{
+		URL:         target,
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		FetchTime:   time.Now(),
+	}
+	if err = store.Put(site, target, body, meta); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// FileSnapshotStore 基于文件系统的快照存储
+// 路径为 <Root>/<site>/<md5[0]>/<md5>.html，开启 Gzip 时为 .html.gz，元数据保存在同名 .json
+type FileSnapshotStore struct {
+	Root string
+	Gzip bool
+}
+
+func NewFileSnapshotStore(root string, gz bool) *FileSnapshotStore {
+	return &FileSnapshotStore{Root: root, Gzip: gz}
+}
+
+// base 快照文件不含扩展名的路径
+func (s *FileSnapshotStore) base(site, target string) string {
+	dir := cgghui.MD5(target)
+	return filepath.Join(s.Root, site, string(dir[0]), dir)
+}
+
+func (s *FileSnapshotStore) Has(site, target string) bool {
+	base := s.base(site, target)
+	return PathExists(base+".html.gz") || PathExists(base+".html")
+}
+
+func (s *FileSnapshotStore) Get(site, target string) ([]byte, SnapshotMeta, error) {
+	base := s.base(site, target)
+	meta := SnapshotMeta{URL: target}
+	if raw, err := os.ReadFile(base + ".json"); err == nil {
+		_ = json.Unmarshal(raw, &meta)
+	}
+	body, err := os.ReadFile(base + ".html.gz")
+	if err == nil {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(body)); err != nil {
+			return nil, meta, err
+		}
+		defer func() {
+			_ = zr.Close()
+		}()
+		if body, err = io.ReadAll(zr); err != nil {
+			return nil, meta, err
+		}
+		return body, meta, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, meta, err
+	}
+	// 兼容未压缩的旧快照
+	if body, err = os.ReadFile(base + ".html"); err != nil {
+		if os.IsNotExist(err) {
+			return nil, meta, ErrSnapshotNotFound
+		}
+		return nil, meta, err
+	}
+	return body, meta, nil
+}
+
+func (s *FileSnapshotStore) Put(site, target string, body []byte, meta SnapshotMeta) error {
+	base := s.base(site, target)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return err
+	}
+	if meta.URL == "" {
+		meta.URL = target
+	}
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err = WriteFileAtomic(base+".json", raw); err != nil {
+		return err
+	}
+	if !s.Gzip {
+		return WriteFileAtomic(base+".html", body)
+	}
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err = zw.Write(body); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = WriteFileAtomic(base+".html.gz", buf.Bytes()); err != nil {
+		return err
+	}
+	// 压缩后的快照已保存，旧的未压缩快照不再需要
+	_ = os.Remove(base + ".html")
+	return nil
+}
+
+// WriteFileMode WriteFileAtomic 与下载的图片的文件权限
+// os.CreateTemp 创建的文件为 0600，重命名前改为该权限，使 Web 服务器等其他用户可以读取
+var WriteFileMode os.FileMode = 0644
+
+// WriteFileAtomic 先写入同目录的临时文件再重命名，避免留下写了一半的文件，文件权限为 WriteFileMode
+func WriteFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if err = tmp.Chmod(WriteFileMode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// MemorySnapshotStore 内存中的快照存储，用于测试
+type MemorySnapshotStore struct {
+	mu   sync.Mutex
+	data map[string]memorySnapshot
+}
+
+type memorySnapshot struct {
+	body []byte
+	meta SnapshotMeta
+}
+
+func NewMemorySnapshotStore() *MemorySnapshotStore {
+	return &MemorySnapshotStore{data: make(map[string]memorySnapshot)}
+}
+
+func (s *MemorySnapshotStore) Has(site, target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.data[site+"\x00"+target]
+	return ok
+}
+
+func (s *MemorySnapshotStore) Get(site, target string) ([]byte, SnapshotMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.data[site+"\x00"+target]
+	if !ok {
+		return nil, SnapshotMeta{URL: target}, ErrSnapshotNotFound
+	}
+	return append([]byte(nil), snap.body...), snap.meta, nil
+}
+
+func (s *MemorySnapshotStore) Put(site, target string, body []byte, meta SnapshotMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if meta.URL == "" {
+		meta.URL = target
+	}
+	s.data[site+"\x00"+target] = memorySnapshot{body: append([]byte(nil), body...), meta: meta}
+	return nil
+}
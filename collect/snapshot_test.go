@@ -0,0 +1,83 @@
+package collect
+
+import (
+	"errors"
+	"github.com/cgghui/cgghui"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFileSnapshotStore(t *testing.T) {
+	for _, gz := range []bool{true, false} {
+		store := NewFileSnapshotStore(t.TempDir(), gz)
+		const target = "https://example.com/a/1.html"
+		if store.Has("site", target) {
+			t.Fatal("unexpected snapshot")
+		}
+		if _, _, err := store.Get("site", target); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Fatalf("error:%v", err)
+		}
+		if err := store.Put("site", target, []byte("<html>ok</html>"), SnapshotMeta{StatusCode: 200}); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+		body, meta, err := store.Get("site", target)
+		if err != nil {
+			t.Fatalf("error:%v", err)
+		}
+		if string(body) != "<html>ok</html>" || meta.StatusCode != 200 || meta.URL != target {
+			t.Fatalf("gzip=%v body=%q meta=%+v", gz, body, meta)
+		}
+	}
+}
+
+func TestFileSnapshotStoreLegacy(t *testing.T) {
+	root := t.TempDir()
+	const target = "https://example.com/a/2.html"
+	dir := cgghui.MD5(target)
+	legacy := filepath.Join(root, "site", string(dir[0]), dir+".html")
+	_ = os.MkdirAll(filepath.Dir(legacy), 0755)
+	if err := os.WriteFile(legacy, []byte("legacy"), 0644); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	store := NewFileSnapshotStore(root, true)
+	if !store.Has("site", target) {
+		t.Fatal("legacy snapshot not found")
+	}
+	body, _, err := store.Get("site", target)
+	if err != nil || string(body) != "legacy" {
+		t.Fatalf("body=%q error:%v", body, err)
+	}
+}
+
+func TestWriteFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file mode is not supported on windows")
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testPNG)
+	}))
+	defer srv.Close()
+	retry := Retry
+	Retry = RetryPolicy{MaxAttempts: 1}
+	defer func() {
+		Retry = retry
+	}()
+	dir := t.TempDir()
+	page, img := filepath.Join(dir, "index.html"), filepath.Join(dir, "a.png")
+	if err := WriteFileAtomic(page, []byte("<html></html>")); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if err := Download(srv.URL+"/a.png", img); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	for _, name := range []string{page, img} {
+		info, err := os.Stat(name)
+		if err != nil || info.Mode().Perm() != 0644 {
+			t.Fatalf("%s: info=%v error:%v", name, info, err)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/cgghui/cgghui"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,6 +25,43 @@ const (
 	TagFashion  Tag = 10 // 时尚
 )
 
+var tagName = map[Tag]string{
+	TagCommerce: "commerce",
+	TagMobile:   "mobile",
+	TagCar:      "car",
+	TagSmart:    "smart",
+	TagIT:       "it",
+	TagTX:       "tx",
+	TagLife:     "life",
+	TagSAB:      "sab",
+	TagScience:  "science",
+	TagDigital:  "digital",
+	TagFashion:  "fashion",
+}
+
+// String 标签的英文名，如：commerce
+func (t Tag) String() string {
+	if name, ok := tagName[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// ParseTag 将英文名或数字解析为标签，无法识别时返回 ErrUndefinedTag
+func ParseTag(s string) (Tag, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for t, name := range tagName {
+		if name == s {
+			return t, nil
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, ErrUndefinedTag
+	}
+	return Tag(n), nil
+}
+
 const (
 	TagClass     = ".tag"
 	TagAttrName  = "data-name"
@@ -35,7 +73,7 @@ const UserAgentSogouSpider = "Sogou web spider/4.0(+http://www.sogou.com/docs/he
 const UserAgentBaiduSpider = "Mozilla/5.0 (compatible; Baiduspider-render/2.0; +http://www.baidu.com/search/spider.html)"
 
 var HttpClient = &http.Client{
-	Timeout: 6 * time.Second,
+	Transport: requestTimeout{},
 	CheckRedirect: func(req *http.Request, via []*http.Request) error {
 		return http.ErrUseLastResponse
 	},
@@ -64,16 +102,20 @@ type ArticleTag struct {
 
 // Article 文章
 type Article struct {
-	Title       string       // 标题
-	Content     string       // 正文
-	Alias       string       // 别名
-	Tag         []ArticleTag // 标签
-	Cate        Category     // 分类
-	AuthorName  string       // 作者
-	PostTime    time.Time    // 发布时间
-	Intro       string       // 摘要
-	Href        string       // 链接
-	LocalImages []string     // 本地下载的图片
+	Title       string        // 标题
+	Content     string        // 正文
+	Alias       string        // 别名
+	Tag         []ArticleTag  // 标签
+	Cate        Category      // 分类
+	AuthorName  string        // 作者
+	PostTime    time.Time     // 发布时间
+	Intro       string        // 摘要
+	Href        string        // 链接
+	LocalImages []string      // 本地下载的图片
+	Images      []ImageRecord // 图片的记录，包括下载失败的
+	Cover       string        // 封面图片，相对 ImgRootPath 的路径，见 SelectCover
+
+	Duplicate *DuplicateMatch `json:",omitempty"` // 近似重复时为来源文章，见 DuplicateIndex
 }
 
 // Category 分类
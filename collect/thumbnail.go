@@ -0,0 +1,188 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/image/draw"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ThumbnailSizes 缩略图的宽度，只生成比原图窄的，为空时不生成
+var ThumbnailSizes = []int{320, 640, 1024}
+
+// ThumbnailQuality JPEG 缩略图的质量，1 ~ 100
+var ThumbnailQuality = 85
+
+// ThumbnailMaxPixels 原图的像素数超过它时不生成缩略图，上传前的 ImageProcess 也不处理，避免解码时占用过多内存
+var ThumbnailMaxPixels = 40 * 1000 * 1000
+
+// CoverMinWidth 作为封面的图片的最小宽度
+var CoverMinWidth = 400
+
+// ImageVariant 图片的一个缩略图
+type ImageVariant struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Path   string `json:"path"` // 相对 ImgRootPath 的保存路径
+}
+
+// variantExt 可生成缩略图的格式，原图扩展名 -> 缩略图扩展名，GIF 只取第一帧，保存为 PNG
+var variantExt = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".png",
+}
+
+// variantPath 缩略图的保存路径，如：/img/ab/abcd.jpg 宽 320 时为 /img/ab/abcd-320w.jpg
+func variantPath(p string, width int, ext string) string {
+	return strings.TrimSuffix(p, path.Ext(p)) + "-" + strconv.Itoa(width) + "w" + ext
+}
+
+// GenerateVariants 按 ThumbnailSizes 生成 rec 的缩略图，保存在原图旁边，已存在的不会重新生成
+// 支持 JPEG、PNG、GIF，其它格式或原图不比任何尺寸宽时返回 nil
+func GenerateVariants(rec ImageRecord) ([]ImageVariant, error) {
+	ext, ok := variantExt[rec.MIME]
+	if !ok || rec.Status != ImageOK || rec.Width <= 0 || rec.Height <= 0 || rec.Width*rec.Height > ThumbnailMaxPixels {
+		return nil, nil
+	}
+	sizes := make([]int, 0, len(ThumbnailSizes))
+	for _, w := range ThumbnailSizes {
+		if w > 0 && w < rec.Width {
+			sizes = append(sizes, w)
+		}
+	}
+	if len(sizes) == 0 {
+		return nil, nil
+	}
+	sort.Ints(sizes)
+	var src image.Image
+	variants := make([]ImageVariant, 0, len(sizes))
+	for _, w := range sizes {
+		if len(variants) > 0 && variants[len(variants)-1].Width == w {
+			continue
+		}
+		h := (rec.Height*w + rec.Width/2) / rec.Width
+		if h < 1 {
+			h = 1
+		}
+		v := ImageVariant{Width: w, Height: h, Path: variantPath(rec.Path, w, ext)}
+		if _, err := os.Stat(ImgRootPath + v.Path); err == nil {
+			variants = append(variants, v)
+			continue
+		}
+		if src == nil {
+			raw, err := os.ReadFile(ImgRootPath + rec.Path)
+			if err != nil {
+				return nil, err
+			}
+			if src, _, err = image.Decode(bytes.NewReader(raw)); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidImage, rec.Path, err)
+			}
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+		buf := &bytes.Buffer{}
+		var err error
+		if ext == ".jpg" {
+			err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: ThumbnailQuality})
+		} else {
+			err = png.Encode(buf, dst)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = WriteFileAtomic(ImgRootPath+v.Path, buf.Bytes()); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, nil
+}
+
+// Srcset img 的 srcset 属性，包括全部缩略图与原图，没有缩略图时返回空字符串
+func (r ImageRecord) Srcset() string {
+	if len(r.Variants) == 0 {
+		return ""
+	}
+	items := make([]string, 0, len(r.Variants)+1)
+	for _, v := range r.Variants {
+		items = append(items, v.Path+" "+strconv.Itoa(v.Width)+"w")
+	}
+	items = append(items, r.Path+" "+strconv.Itoa(r.Width)+"w")
+	return strings.Join(items, ", ")
+}
+
+// Thumbnail 宽度不小于 width 的最小的缩略图，没有时返回原图
+func (r ImageRecord) Thumbnail(width int) string {
+	for _, v := range r.Variants {
+		if v.Width >= width {
+			return v.Path
+		}
+	}
+	return r.Path
+}
+
+// SetSrcset 按 rec 设置 img 的 srcset 与 sizes 属性，没有缩略图时移除这两个属性，以免引用原站的图片
+func SetSrcset(img *goquery.Selection, rec ImageRecord) {
+	srcset := rec.Srcset()
+	if srcset == "" {
+		img.RemoveAttr("srcset")
+		img.RemoveAttr("sizes")
+		return
+	}
+	img.SetAttr("srcset", srcset)
+	img.SetAttr("sizes", fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", rec.Width, rec.Width))
+}
+
+// SelectCover 选择文章的封面，保存到 art.Cover
+// 依次为：正文中第一张宽度不小于 CoverMinWidth 的图片、ogImage、正文中第一张图片；
+// ogImage 不在正文中时会下载，成功时追加到 art.Images 与 art.LocalImages
+func SelectCover(ctx context.Context, art *Article, ogImage string) {
+	for _, rec := range art.Images {
+		if rec.Status == ImageOK && rec.Width >= CoverMinWidth {
+			art.Cover = rec.Path
+			return
+		}
+	}
+	if ogImage = strings.TrimSpace(ogImage); ogImage != "" {
+		if rec, ok := findImage(art.Images, ogImage); ok {
+			if rec.Status == ImageOK {
+				art.Cover = rec.Path
+				return
+			}
+		} else if rec, err := downloadImageRecord(ctx, ogImage); err == nil {
+			rec.Variants, _ = GenerateVariants(rec)
+			art.Images = append(art.Images, rec)
+			art.LocalImages = append(art.LocalImages, rec.Path)
+			for _, v := range rec.Variants {
+				art.LocalImages = append(art.LocalImages, v.Path)
+			}
+			art.Cover = rec.Path
+			return
+		}
+	}
+	for _, rec := range art.Images {
+		if rec.Status == ImageOK {
+			art.Cover = rec.Path
+			return
+		}
+	}
+}
+
+func findImage(images []ImageRecord, imgURL string) (ImageRecord, bool) {
+	for _, rec := range images {
+		if rec.URL == imgURL {
+			return rec, true
+		}
+	}
+	return ImageRecord{}, false
+}
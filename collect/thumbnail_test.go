@@ -0,0 +1,154 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"github.com/PuerkitoBio/goquery"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// encodeTestImage 生成 w x h 的渐变图片，format 为 jpeg 或 png
+func encodeTestImage(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(buf, img, nil)
+	} else {
+		err = png.Encode(buf, img)
+	}
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerateVariants(t *testing.T) {
+	root, sizes := ImgRootPath, ThumbnailSizes
+	ImgRootPath, ThumbnailSizes = t.TempDir(), []int{1024, 100, 300, 100}
+	defer func() {
+		ImgRootPath, ThumbnailSizes = root, sizes
+	}()
+	if err := os.MkdirAll(ImgRootPath+"/img/ab", 0755); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if err := os.WriteFile(ImgRootPath+"/img/ab/abcd.jpg", encodeTestImage(t, "jpeg", 600, 400), 0644); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	rec, err := StatImage("/img/ab/abcd.jpg")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if rec.Variants, err = GenerateVariants(rec); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	want := []ImageVariant{
+		{Width: 100, Height: 67, Path: "/img/ab/abcd-100w.jpg"},
+		{Width: 300, Height: 200, Path: "/img/ab/abcd-300w.jpg"},
+	}
+	if len(rec.Variants) != len(want) {
+		t.Fatalf("variants=%+v", rec.Variants)
+	}
+	for i, v := range rec.Variants {
+		if v != want[i] {
+			t.Fatalf("variant %d = %+v, want %+v", i, v, want[i])
+		}
+		got, err := StatImage(v.Path)
+		if err != nil || got.Width != v.Width || got.Height != v.Height || got.MIME != "image/jpeg" {
+			t.Fatalf("%s: %+v error:%v", v.Path, got, err)
+		}
+	}
+	if s := rec.Srcset(); s != "/img/ab/abcd-100w.jpg 100w, /img/ab/abcd-300w.jpg 300w, /img/ab/abcd.jpg 600w" {
+		t.Fatalf("srcset=%s", s)
+	}
+	if p := rec.Thumbnail(200); p != "/img/ab/abcd-300w.jpg" {
+		t.Fatalf("thumbnail=%s", p)
+	}
+	if p := rec.Thumbnail(800); p != rec.Path {
+		t.Fatalf("thumbnail=%s", p)
+	}
+
+	// 比全部尺寸都窄的图片与不支持的格式不生成
+	rec.Width = 80
+	if v, err := GenerateVariants(rec); v != nil || err != nil {
+		t.Fatalf("variants=%+v error:%v", v, err)
+	}
+	rec.Width, rec.MIME = 600, "image/webp"
+	if v, err := GenerateVariants(rec); v != nil || err != nil {
+		t.Fatalf("variants=%+v error:%v", v, err)
+	}
+}
+
+func TestSelectCover(t *testing.T) {
+	big, small := encodeTestImage(t, "png", 500, 300), encodeTestImage(t, "png", 50, 30)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big.png", "/og.png":
+			_, _ = w.Write(big)
+		case "/small.png":
+			_, _ = w.Write(small)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	root, retry, sizes := ImgRootPath, Retry, ThumbnailSizes
+	ImgRootPath, Retry, ThumbnailSizes = t.TempDir(), RetryPolicy{MaxAttempts: 1}, []int{200}
+	defer func() {
+		ImgRootPath, Retry, ThumbnailSizes = root, retry, sizes
+	}()
+	ctx := context.Background()
+
+	page := `<div><img src="/small.png" srcset="/small@2x.png 2x"><img src="/big.png"></div>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(strings.ReplaceAll(page, `="/`, `="`+srv.URL+`/`)))
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	art := &Article{}
+	err = DownloadImages(ctx, art, doc.Find("img"), func(el *goquery.Selection) string {
+		return el.AttrOr("src", "")
+	}, nil)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if len(art.LocalImages) != 3 || len(art.Images[1].Variants) != 1 {
+		t.Fatalf("local=%v images=%+v", art.LocalImages, art.Images)
+	}
+	imgs := doc.Find("img")
+	if _, ok := imgs.Eq(0).Attr("srcset"); ok {
+		t.Fatalf("srcset of the original site was kept")
+	}
+	bigRec := art.Images[1]
+	if s := imgs.Eq(1).AttrOr("srcset", ""); s != bigRec.Srcset() || imgs.Eq(1).AttrOr("sizes", "") != "(max-width: 500px) 100vw, 500px" {
+		t.Fatalf("srcset=%s", s)
+	}
+	SelectCover(ctx, art, srv.URL+"/og.png")
+	if art.Cover != bigRec.Path {
+		t.Fatalf("cover=%s, want the first large image", art.Cover)
+	}
+
+	// 没有大图时使用 og:image，下载失败时使用第一张图片
+	art = &Article{Images: art.Images[:1], LocalImages: art.LocalImages[:1]}
+	SelectCover(ctx, art, srv.URL+"/missing.png")
+	if art.Cover != art.Images[0].Path || len(art.Images) != 1 {
+		t.Fatalf("cover=%s images=%+v", art.Cover, art.Images)
+	}
+	SelectCover(ctx, art, srv.URL+"/og.png")
+	if len(art.Images) != 2 || art.Cover != art.Images[1].Path || len(art.LocalImages) != 3 {
+		t.Fatalf("cover=%s local=%v", art.Cover, art.LocalImages)
+	}
+}
@@ -0,0 +1,59 @@
+package collect_test
+
+import (
+	"context"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/collect/collecttest"
+	"github.com/cgghui/bt_site_cluster_collect/panel/paneltest"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestUploadQueuePanel 下载图片后经上传队列上传到模拟的宝塔面板
+func TestUploadQueuePanel(t *testing.T) {
+	collecttest.Install(t, map[string]string{
+		"https://www.nbtimes.net/wp-content/uploads/2022/04/a.png": "testdata/selector/img.png",
+	})
+	retry := collect.UploadRetry
+	collect.UploadRetry = collect.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	defer func() {
+		collect.UploadRetry = retry
+	}()
+	imgPath, err := collect.DownloadImage("https://www.nbtimes.net/wp-content/uploads/2022/04/a.png")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	srv := paneltest.NewServer(t, "secret")
+	srv.FailNext("upload", 1)
+	queue, err := collect.OpenUploadQueue("")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if _, err = queue.Enqueue("bt1", "/www/wwwroot/example.com", imgPath); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	get := func(string) (collect.Uploader, error) { return srv.Client(), nil }
+	ctx := context.Background()
+	if res, err := queue.Flush(ctx, "", true, get); err != nil || res.Retrying != 1 {
+		t.Fatalf("result=%+v error:%v", res, err)
+	}
+	if res, err := queue.Flush(ctx, "", true, get); err != nil || res.Uploaded != 1 {
+		t.Fatalf("result=%+v error:%v", res, err)
+	}
+	want, err := os.ReadFile("testdata/selector/img.png")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	got, err := srv.ReadFile("/www/wwwroot/example.com" + imgPath)
+	if err != nil || string(got) != string(want) {
+		t.Fatalf("uploaded %d bytes, error:%v", len(got), err)
+	}
+	if files := srv.Files("/www/wwwroot"); len(files) != 1 {
+		t.Fatalf("files=%v", files)
+	}
+	// 路径越界的图片不会上传
+	if err = collect.UploadImage(srv.Client(), "/www/wwwroot/example.com", "/../../etc/passwd"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
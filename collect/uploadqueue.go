@@ -0,0 +1,279 @@
+package collect
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UploadQueuePath 默认的上传队列文件
+const UploadQueuePath = "./upload_queue.jsonl"
+
+// UploadRetry 上传失败时的重试策略，达到 MaxAttempts 后标记为 UploadFailed；
+// IsPermanentUploadError 的错误不重试，第一次失败即标记为 UploadFailed
+var UploadRetry = RetryPolicy{MaxAttempts: 8, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, Jitter: 0.2}
+
+// UploadStatus 上传状态
+type UploadStatus string
+
+const (
+	UploadPending  UploadStatus = "pending"  // 等待上传或等待重试
+	UploadUploaded UploadStatus = "uploaded" // 已上传
+	UploadFailed   UploadStatus = "failed"   // 重试次数用完或重试也不会成功，需要 Requeue 后才会再次上传
+)
+
+// UploadEntry 一个待上传到宝塔面板的图片
+type UploadEntry struct {
+	Panel     string       `json:"panel"`     // 面板名称
+	SiteRoot  string       `json:"site_root"` // 站点在服务器上的根目录
+	Path      string       `json:"path"`      // 相对 ImgRootPath 的图片路径，同 LocalImages
+	Status    UploadStatus `json:"status"`
+	Attempts  int          `json:"attempts"`             // 已尝试的次数
+	Error     string       `json:"error,omitempty"`      // 最后一次失败的原因
+	NextRetry time.Time    `json:"next_retry,omitempty"` // 下一次重试的最早时间
+	Updated   time.Time    `json:"updated"`
+}
+
+// UploadResult Flush 的结果
+type UploadResult struct {
+	Uploaded int // 本次上传成功的数量
+	Retrying int // 本次失败、等待重试的数量
+	Failed   int // 本次失败且不再重试的数量
+}
+
+// UploaderFunc 按面板名称取得上传使用的 Uploader
+type UploaderFunc func(panel string) (Uploader, error)
+
+// UploadQueue 持久化的图片上传队列，按 面板 + 站点根目录 + 图片路径 区分
+// 记录以 JSON Lines 追加写入文件，打开时按顺序回放，同一图片以最后一行为准，因此重启后可以继续上传
+type UploadQueue struct {
+	mu      sync.Mutex
+	path    string
+	fp      *os.File
+	entries map[string]*UploadEntry
+}
+
+// OpenUploadQueue 打开队列文件，不存在时创建；path 为空时只保存在内存中
+func OpenUploadQueue(path string) (*UploadQueue, error) {
+	q := &UploadQueue{path: path, entries: make(map[string]*UploadEntry)}
+	if path == "" {
+		return q, nil
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	q.fp = fp
+	return q, nil
+}
+
+func (q *UploadQueue) load() error {
+	fp, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		var e UploadEntry
+		// 写了一半的最后一行直接忽略
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Path == "" {
+			continue
+		}
+		q.entries[uploadKey(e.Panel, e.SiteRoot, e.Path)] = &e
+	}
+	return scanner.Err()
+}
+
+func uploadKey(panel, siteRoot, imgPath string) string {
+	return panel + "\x00" + siteRoot + "\x00" + imgPath
+}
+
+func (q *UploadQueue) append(e *UploadEntry) error {
+	e.Updated = time.Now()
+	if q.fp == nil {
+		return nil
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = q.fp.Write(append(raw, '\n'))
+	return err
+}
+
+// Enqueue 加入队列，已上传或已在队列中的图片不会重复加入，返回是否加入
+func (q *UploadQueue) Enqueue(panel, siteRoot, imgPath string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := uploadKey(panel, siteRoot, imgPath)
+	if _, ok := q.entries[key]; ok {
+		return false, nil
+	}
+	e := &UploadEntry{Panel: panel, SiteRoot: siteRoot, Path: imgPath, Status: UploadPending}
+	q.entries[key] = e
+	return true, q.append(e)
+}
+
+// Requeue 将 panel 的失败记录重新加入队列，panel 为空时为全部面板，返回数量
+func (q *UploadQueue) Requeue(panel string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, e := range q.entries {
+		if e.Status != UploadFailed || (panel != "" && e.Panel != panel) {
+			continue
+		}
+		e.Status, e.Attempts, e.NextRetry = UploadPending, 0, time.Time{}
+		if err := q.append(e); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Entries 全部记录，按面板、站点根目录与图片路径排序
+func (q *UploadQueue) Entries() []UploadEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r := make([]UploadEntry, 0, len(q.entries))
+	for _, e := range q.entries {
+		r = append(r, *e)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Panel != r[j].Panel {
+			return r[i].Panel < r[j].Panel
+		}
+		if r[i].SiteRoot != r[j].SiteRoot {
+			return r[i].SiteRoot < r[j].SiteRoot
+		}
+		return r[i].Path < r[j].Path
+	})
+	return r
+}
+
+// Flush 上传 panel 中到了重试时间的待上传图片，panel 为空时为全部面板
+// force 为 true 时忽略重试时间；ctx 取消时停止并返回 ctx.Err()，已完成的结果已保存
+func (q *UploadQueue) Flush(ctx context.Context, panel string, force bool, get UploaderFunc) (UploadResult, error) {
+	var res UploadResult
+	now := time.Now()
+	uploaders := make(map[string]Uploader)
+	for _, e := range q.Entries() {
+		if e.Status != UploadPending || (panel != "" && e.Panel != panel) || (!force && now.Before(e.NextRetry)) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		u, ok := uploaders[e.Panel]
+		var err error
+		if !ok {
+			if u, err = get(e.Panel); err == nil {
+				uploaders[e.Panel] = u
+			}
+		}
+		if err == nil {
+			err = UploadImage(u, e.SiteRoot, e.Path)
+		}
+		var status UploadStatus
+		if status, err = q.done(e, err); err != nil {
+			return res, err
+		}
+		switch status {
+		case UploadUploaded:
+			res.Uploaded++
+		case UploadFailed:
+			res.Failed++
+		default:
+			res.Retrying++
+		}
+	}
+	return res, nil
+}
+
+// IsPermanentUploadError 上传失败的原因是否重试也不会成功：
+// 路径不安全、本地图片不存在、图片无法解码或过大、无法去掉元数据
+func IsPermanentUploadError(err error) bool {
+	return errors.Is(err, ErrUnsafePath) || errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrInvalidImage) ||
+		errors.Is(err, ErrImageTooLarge) || errors.Is(err, ErrStripMetadata)
+}
+
+// done 记录一次上传的结果，返回新的状态
+func (q *UploadQueue) done(e UploadEntry, uploadErr error) (UploadStatus, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cur, ok := q.entries[uploadKey(e.Panel, e.SiteRoot, e.Path)]
+	if !ok {
+		return "", nil
+	}
+	cur.Attempts++
+	if uploadErr == nil {
+		cur.Status, cur.Error, cur.NextRetry = UploadUploaded, "", time.Time{}
+		return cur.Status, q.append(cur)
+	}
+	cur.Error = uploadErr.Error()
+	if cur.Attempts >= UploadRetry.MaxAttempts || IsPermanentUploadError(uploadErr) {
+		cur.Status, cur.NextRetry = UploadFailed, time.Time{}
+	} else {
+		cur.NextRetry = time.Now().Add(UploadRetry.Backoff(cur.Attempts))
+	}
+	return cur.Status, q.append(cur)
+}
+
+// Compact 用当前记录重写文件，去掉被覆盖的旧行
+func (q *UploadQueue) Compact() error {
+	entries := q.Entries()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.fp == nil {
+		return nil
+	}
+	buf := make([]byte, 0)
+	for i := range entries {
+		raw, err := json.Marshal(&entries[i])
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, raw...), '\n')
+	}
+	if err := WriteFileAtomic(q.path, buf); err != nil {
+		return err
+	}
+	_ = q.fp.Close()
+	fp, err := os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		q.fp = nil
+		return err
+	}
+	q.fp = fp
+	return nil
+}
+
+func (q *UploadQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.fp == nil {
+		return nil
+	}
+	err := q.fp.Close()
+	q.fp = nil
+	return err
+}
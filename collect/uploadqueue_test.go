@@ -0,0 +1,152 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var errUploadDown = errors.New("panel down")
+
+// fakeUploader 前 fail 次上传失败，成功时记录服务器路径与内容
+type fakeUploader struct {
+	fail  int
+	files map[string]string
+}
+
+func (f *fakeUploader) UploadWithTimeout(_ time.Duration, name, serverPath string, fp *os.File, _ bool) error {
+	if f.fail > 0 {
+		f.fail--
+		return errUploadDown
+	}
+	raw, err := io.ReadAll(fp)
+	if err != nil {
+		return err
+	}
+	f.files[serverPath+"/"+filepath.Base(name)] = string(raw)
+	return nil
+}
+
+func TestUploadQueue(t *testing.T) {
+	root, retry := ImgRootPath, UploadRetry
+	ImgRootPath, UploadRetry = t.TempDir(), RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}
+	defer func() {
+		ImgRootPath, UploadRetry = root, retry
+	}()
+	for _, p := range []string{"/img/aa/a.png", "/img/bb/b.png"} {
+		if err := os.MkdirAll(filepath.Dir(ImgRootPath+p), 0755); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+		if err := os.WriteFile(ImgRootPath+p, []byte(p), 0644); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	queue, err := OpenUploadQueue(path)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	for _, p := range []string{"/img/aa/a.png", "/img/bb/b.png", "/img/aa/a.png"} {
+		if _, err = queue.Enqueue("bt1", "/www/wwwroot/example.com", p); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+	}
+	if len(queue.Entries()) != 2 {
+		t.Fatalf("entries=%v", queue.Entries())
+	}
+	up := &fakeUploader{fail: 1, files: make(map[string]string)}
+	get := func(string) (Uploader, error) { return up, nil }
+	ctx := context.Background()
+	res, err := queue.Flush(ctx, "", false, get)
+	if err != nil || res.Uploaded != 1 || res.Retrying != 1 {
+		t.Fatalf("result=%+v error:%v", res, err)
+	}
+	if up.files["/www/wwwroot/example.com/img/bb/b.png"] != "/img/bb/b.png" {
+		t.Fatalf("files=%v", up.files)
+	}
+	// 未到重试时间，不上传
+	if res, _ = queue.Flush(ctx, "", false, get); res != (UploadResult{}) {
+		t.Fatalf("result=%+v", res)
+	}
+	if err = queue.Close(); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+
+	// 重启后继续，重试次数用完后标记为失败
+	if queue, err = OpenUploadQueue(path); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	defer func() {
+		_ = queue.Close()
+	}()
+	up.fail = 2
+	for i := 0; i < 2; i++ {
+		if res, err = queue.Flush(ctx, "bt1", true, get); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+	}
+	if res.Failed != 1 {
+		t.Fatalf("result=%+v", res)
+	}
+	entries := queue.Entries()
+	if entries[0].Status != UploadFailed || entries[0].Attempts != 3 || entries[0].Error != errUploadDown.Error() || entries[1].Status != UploadUploaded {
+		t.Fatalf("entries=%+v", entries)
+	}
+	if n, err := queue.Requeue("bt1"); n != 1 || err != nil {
+		t.Fatalf("requeue=%d error:%v", n, err)
+	}
+	if err = queue.Compact(); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if res, err = queue.Flush(ctx, "", false, get); err != nil || res.Uploaded != 1 {
+		t.Fatalf("result=%+v error:%v", res, err)
+	}
+	if len(up.files) != 2 {
+		t.Fatalf("files=%v", up.files)
+	}
+}
+
+func TestUploadQueuePermanent(t *testing.T) {
+	root, retry := ImgRootPath, UploadRetry
+	ImgRootPath, UploadRetry = t.TempDir(), RetryPolicy{MaxAttempts: 8, BaseDelay: time.Hour}
+	defer func() {
+		ImgRootPath, UploadRetry = root, retry
+	}()
+	if err := os.MkdirAll(ImgRootPath+"/img", 0755); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if err := os.WriteFile(ImgRootPath+"/img/broken.png", testPNG, 0644); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if err := SetImageProcess("/www/wwwroot/permanent.test", ImageProcess{StripMetadata: true}); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	queue, err := OpenUploadQueue("")
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	// 本地图片不存在、路径不安全、图片无法解码，第一次失败即标记为失败
+	for _, p := range []string{"/img/missing.png", "/../../etc/passwd", "/img/broken.png"} {
+		if _, err = queue.Enqueue("bt1", "/www/wwwroot/permanent.test", p); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+	}
+	up := &fakeUploader{files: make(map[string]string)}
+	res, err := queue.Flush(context.Background(), "", false, func(string) (Uploader, error) { return up, nil })
+	if err != nil || res.Failed != 3 || res.Retrying != 0 || len(up.files) != 0 {
+		t.Fatalf("result=%+v files=%v error:%v", res, up.files, err)
+	}
+	for _, e := range queue.Entries() {
+		if e.Status != UploadFailed || e.Attempts != 1 || e.Error == "" {
+			t.Fatalf("entry=%+v", e)
+		}
+	}
+	if !IsPermanentUploadError(fmt.Errorf("x: %w", ErrStripMetadata)) || IsPermanentUploadError(errUploadDown) {
+		t.Fatal("IsPermanentUploadError")
+	}
+}
@@ -0,0 +1,101 @@
+// Package export 将采集到的文章导出为其它 CMS 可导入的文件
+package export
+
+import (
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"regexp"
+	"strings"
+)
+
+// Exporter 文章导出
+// 依次调用 Write 写入文章，全部写完后调用 Close 补全文件结尾
+type Exporter interface {
+	Write(art *collect.Article) error
+	Close() error
+}
+
+// Options 导出选项
+type Options struct {
+	Title        string // 站点名称，用于 WXR
+	Link         string // 站点地址，用于 WXR
+	ImageBaseURL string // LocalImages 中的图片路径改写为以此开头的地址，为空时不改写
+}
+
+// ImageURL 将 LocalImages 中的路径改写为以 baseURL 开头的地址
+func ImageURL(baseURL, imgPath string) string {
+	if baseURL == "" {
+		return imgPath
+	}
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(imgPath, "/")
+}
+
+var srcsetAttr = regexp.MustCompile(`srcset="[^"]*"`)
+
+// RewriteImages 返回图片地址改写后的文章副本，art 本身不变
+// 改写 LocalImages、Cover、Images，以及正文中 src 与 srcset 里属于 LocalImages 的地址
+func RewriteImages(art *collect.Article, baseURL string) *collect.Article {
+	if baseURL == "" || len(art.LocalImages) == 0 {
+		return art
+	}
+	urls := make(map[string]string, len(art.LocalImages))
+	for _, p := range art.LocalImages {
+		urls[p] = ImageURL(baseURL, p)
+	}
+	return ReplaceImages(art, urls)
+}
+
+// ReplaceImages 返回图片地址改写后的文章副本，art 本身不变
+// urls 为本地图片路径 -> 新地址，改写 LocalImages、Cover、Images 中的 Path 与 Variants，
+// 以及正文中 src 与 srcset 里的地址，不在 urls 中的不变
+func ReplaceImages(art *collect.Article, urls map[string]string) *collect.Article {
+	if len(urls) == 0 {
+		return art
+	}
+	cp := *art
+	cp.LocalImages = make([]string, len(art.LocalImages))
+	for i, p := range art.LocalImages {
+		cp.LocalImages[i] = replaceImage(urls, p)
+	}
+	cp.Cover = replaceImage(urls, art.Cover)
+	if art.Images != nil {
+		cp.Images = make([]collect.ImageRecord, len(art.Images))
+		for i, rec := range art.Images {
+			rec.Path = replaceImage(urls, rec.Path)
+			if rec.Variants != nil {
+				variants := make([]collect.ImageVariant, len(rec.Variants))
+				for j, v := range rec.Variants {
+					v.Path = replaceImage(urls, v.Path)
+					variants[j] = v
+				}
+				rec.Variants = variants
+			}
+			cp.Images[i] = rec
+		}
+	}
+	pairs := make([]string, 0, len(urls)*2)
+	for p, u := range urls {
+		pairs = append(pairs, `src="`+p+`"`, `src="`+u+`"`)
+	}
+	cp.Content = strings.NewReplacer(pairs...).Replace(art.Content)
+	// srcset 为 "地址 宽度w, 地址 宽度w"，逐个改写其中的地址
+	cp.Content = srcsetAttr.ReplaceAllStringFunc(cp.Content, func(attr string) string {
+		items := strings.Split(attr[len(`srcset="`):len(attr)-1], ",")
+		for i, item := range items {
+			fields := strings.Fields(item)
+			if len(fields) > 0 {
+				fields[0] = replaceImage(urls, fields[0])
+			}
+			items[i] = strings.Join(fields, " ")
+		}
+		return `srcset="` + strings.Join(items, ", ") + `"`
+	})
+	return &cp
+}
+
+// replaceImage urls 中 p 的新地址，不在 urls 中时为 p
+func replaceImage(urls map[string]string, p string) string {
+	if u, ok := urls[p]; ok {
+		return u
+	}
+	return p
+}
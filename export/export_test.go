@@ -0,0 +1,176 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var article = collect.Article{
+	Title:       "电商平台发布商家扶持新规",
+	Content:     `<p>正文]]>结束</p><img src="/wp-content/uploads/2022/04/a.png"/>`,
+	Href:        "https://www.nbtimes.net/yaowen/1001.html",
+	AuthorName:  "蓝科技",
+	PostTime:    time.Date(2022, 4, 20, 10, 30, 0, 0, time.FixedZone("CST", 8*3600)),
+	Tag:         []collect.ArticleTag{{Name: "电商", Tag: "dianshang"}},
+	Cate:        collect.Category{Name: "要闻", Alias: "yaowen"},
+	LocalImages: []string{"/wp-content/uploads/2022/04/a.png"},
+}
+
+const imageBaseURL = "https://img.example.com/"
+
+func TestRewriteImages(t *testing.T) {
+	got := RewriteImages(&article, imageBaseURL)
+	if got.LocalImages[0] != "https://img.example.com/wp-content/uploads/2022/04/a.png" {
+		t.Fatalf("local images=%v", got.LocalImages)
+	}
+	if !strings.Contains(got.Content, `src="https://img.example.com/wp-content/uploads/2022/04/a.png"`) {
+		t.Fatalf("content=%s", got.Content)
+	}
+	if article.LocalImages[0] != "/wp-content/uploads/2022/04/a.png" {
+		t.Fatal("original article modified")
+	}
+}
+
+func TestRewriteImagesThumbnails(t *testing.T) {
+	art := article
+	art.Content = `<p>正文</p><img src="/img/a.jpg" srcset="/img/a-320w.jpg 320w, /img/a-640w.jpg 640w, /img/a.jpg 1200w" sizes="(max-width: 1200px) 100vw, 1200px"/>`
+	art.LocalImages = []string{"/img/a.jpg", "/img/a-320w.jpg", "/img/a-640w.jpg"}
+	art.Cover = "/img/a.jpg"
+	art.Images = []collect.ImageRecord{
+		{URL: "https://www.nbtimes.net/a.jpg", Path: "/img/a.jpg", Width: 1200, Status: collect.ImageOK, Variants: []collect.ImageVariant{
+			{Width: 320, Path: "/img/a-320w.jpg"}, {Width: 640, Path: "/img/a-640w.jpg"},
+		}},
+		{URL: "https://www.nbtimes.net/b.jpg", Status: collect.ImageFailed, Error: "404"},
+	}
+	want := `<p>正文</p><img src="https://img.example.com/img/a.jpg" srcset="https://img.example.com/img/a-320w.jpg 320w, https://img.example.com/img/a-640w.jpg 640w, https://img.example.com/img/a.jpg 1200w" sizes="(max-width: 1200px) 100vw, 1200px"/>`
+	got := RewriteImages(&art, imageBaseURL)
+	if got.Content != want {
+		t.Fatalf("content=%s", got.Content)
+	}
+	if got.Cover != "https://img.example.com/img/a.jpg" || art.Cover != "/img/a.jpg" {
+		t.Fatalf("cover=%s original=%s", got.Cover, art.Cover)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := NewJSONL(buf, Options{ImageBaseURL: imageBaseURL}).Write(&art); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	var exported collect.Article
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if exported.Content != want || exported.Cover != got.Cover {
+		t.Fatalf("exported=%+v", exported)
+	}
+	// Images 中的路径与 LocalImages 一致，下载失败的记录不变
+	rec := exported.Images[0]
+	if rec.Path != "https://img.example.com/img/a.jpg" || len(rec.Variants) != 2 ||
+		rec.Variants[0].Path != "https://img.example.com/img/a-320w.jpg" || rec.Variants[1].Path != "https://img.example.com/img/a-640w.jpg" {
+		t.Fatalf("images=%+v", exported.Images)
+	}
+	if exported.Images[1].Path != "" || exported.Images[1].Status != collect.ImageFailed {
+		t.Fatalf("images=%+v", exported.Images)
+	}
+	if art.Images[0].Path != "/img/a.jpg" || art.Images[0].Variants[0].Path != "/img/a-320w.jpg" {
+		t.Fatalf("original images modified: %+v", art.Images)
+	}
+}
+
+func TestWXR(t *testing.T) {
+	buf := &bytes.Buffer{}
+	x := NewWXR(buf, Options{Title: "示例站", Link: "https://www.example.com", ImageBaseURL: imageBaseURL})
+	for i := 0; i < 2; i++ {
+		if err := x.Write(&article); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+	}
+	if err := x.Close(); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	var doc struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title    string `xml:"title"`
+				PubDate  string `xml:"pubDate"`
+				Content  string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+				PostID   int    `xml:"http://wordpress.org/export/1.2/ post_id"`
+				Category []struct {
+					Domain   string `xml:"domain,attr"`
+					Nicename string `xml:"nicename,attr"`
+					Name     string `xml:",chardata"`
+				} `xml:"category"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("error:%v\n%s", err, buf.Bytes())
+	}
+	if doc.Channel.Title != "示例站" || len(doc.Channel.Items) != 2 {
+		t.Fatalf("doc=%+v", doc)
+	}
+	item := doc.Channel.Items[1]
+	if item.PostID != 2 || item.PubDate != "Wed, 20 Apr 2022 10:30:00 +0800" {
+		t.Fatalf("item=%+v", item)
+	}
+	if !strings.Contains(item.Content, "]]>结束") || !strings.Contains(item.Content, imageBaseURL) {
+		t.Fatalf("content=%s", item.Content)
+	}
+	if len(item.Category) != 2 || item.Category[0].Domain != "category" || item.Category[1].Domain != "post_tag" || item.Category[1].Nicename != "dianshang" {
+		t.Fatalf("category=%+v", item.Category)
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	buf := &bytes.Buffer{}
+	j := NewJSONL(buf, Options{ImageBaseURL: imageBaseURL})
+	_ = j.Write(&article)
+	_ = j.Write(&article)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines=%d", len(lines))
+	}
+	var got collect.Article
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil || !strings.HasPrefix(got.LocalImages[0], imageBaseURL) {
+		t.Fatalf("got=%+v error:%v", got, err)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewMarkdown(dir, true, Options{ImageBaseURL: imageBaseURL})
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if err = m.Write(&article); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "2022-04-20-"+Slug(&article)+".md"))
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	const head = `---
+title: 电商平台发布商家扶持新规
+date: 2022-04-20T10:30:00+08:00
+author: 蓝科技
+categories:
+    - 要闻
+tags:
+    - 电商
+images:
+    - https://img.example.com/wp-content/uploads/2022/04/a.png
+source: https://www.nbtimes.net/yaowen/1001.html
+---
+
+<p>`
+	if !strings.HasPrefix(string(raw), head) {
+		t.Fatalf("markdown=\n%s", raw)
+	}
+}
@@ -0,0 +1,27 @@
+package export
+
+import (
+	"encoding/json"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"io"
+)
+
+// JSONL 每行一篇文章的 JSON Lines
+type JSONL struct {
+	opt Options
+	enc *json.Encoder
+}
+
+func NewJSONL(w io.Writer, opt Options) *JSONL {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &JSONL{opt: opt, enc: enc}
+}
+
+func (j *JSONL) Write(art *collect.Article) error {
+	return j.enc.Encode(RewriteImages(art, j.opt.ImageBaseURL))
+}
+
+func (j *JSONL) Close() error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package export
+
+import (
+	"bytes"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/cgghui"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Markdown 每篇文章一个带 YAML front matter 的 Markdown 文件，适用于 Hugo 与 Jekyll
+// 正文保留为 HTML，Hugo 需开启 markup.goldmark.renderer.unsafe
+type Markdown struct {
+	Dir    string
+	Jekyll bool // 文件名使用 Jekyll 的 YYYY-MM-DD-slug.md，否则为 slug.md
+	opt    Options
+}
+
+func NewMarkdown(dir string, jekyll bool, opt Options) (*Markdown, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Markdown{Dir: dir, Jekyll: jekyll, opt: opt}, nil
+}
+
+// frontMatter Hugo 与 Jekyll 通用的字段
+type frontMatter struct {
+	Title       string    `yaml:"title"`
+	Date        time.Time `yaml:"date,omitempty"`
+	Author      string    `yaml:"author,omitempty"`
+	Slug        string    `yaml:"slug,omitempty"`
+	Description string    `yaml:"description,omitempty"`
+	Categories  []string  `yaml:"categories,omitempty"`
+	Tags        []string  `yaml:"tags,omitempty"`
+	Images      []string  `yaml:"images,omitempty"`
+	Source      string    `yaml:"source,omitempty"`
+}
+
+// Slug 文章的文件名，优先使用 Alias，否则为链接的 MD5
+func Slug(art *collect.Article) string {
+	if art.Alias != "" && !strings.ContainsAny(art.Alias, `/\`) && art.Alias != "." && art.Alias != ".." {
+		return art.Alias
+	}
+	return cgghui.MD5(art.Href)
+}
+
+func (m *Markdown) Write(art *collect.Article) error {
+	art = RewriteImages(art, m.opt.ImageBaseURL)
+	fm := frontMatter{
+		Title:       art.Title,
+		Date:        art.PostTime,
+		Author:      art.AuthorName,
+		Slug:        art.Alias,
+		Description: art.Intro,
+		Images:      art.LocalImages,
+		Source:      art.Href,
+	}
+	if art.Cate.Name != "" {
+		fm.Categories = []string{art.Cate.Name}
+	}
+	for _, tg := range art.Tag {
+		if tg.Name != "" {
+			fm.Tags = append(fm.Tags, tg.Name)
+		}
+	}
+	head, err := yaml.Marshal(fm)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("---\n")
+	buf.Write(head)
+	buf.WriteString("---\n\n")
+	buf.WriteString(art.Content)
+	buf.WriteString("\n")
+	name := Slug(art) + ".md"
+	if m.Jekyll {
+		date := art.PostTime
+		if date.IsZero() {
+			date = time.Now()
+		}
+		name = date.Format("2006-01-02") + "-" + name
+	}
+	return collect.WriteFileAtomic(filepath.Join(m.Dir, name), buf.Bytes())
+}
+
+func (m *Markdown) Close() error {
+	return nil
+}
@@ -0,0 +1,148 @@
+package export
+
+import (
+	"encoding/xml"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"io"
+	"time"
+)
+
+const wxrHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:wfw="http://wellformedweb.org/CommentAPI/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+`
+
+const wxrFooter = `
+</channel>
+</rss>
+`
+
+// WXR WordPress 导出格式（WordPress eXtended RSS 1.2），可在 WordPress 后台“工具 - 导入”中导入
+// 分类取自 Article.Cate，标签取自 Article.Tag
+type WXR struct {
+	w      io.Writer
+	opt    Options
+	enc    *xml.Encoder
+	nextID int
+	header bool
+}
+
+func NewWXR(w io.Writer, opt Options) *WXR {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	return &WXR{w: w, opt: opt, enc: enc, nextID: 1}
+}
+
+type wxrCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+type wxrCategory struct {
+	Domain   string `xml:"domain,attr"`
+	Nicename string `xml:"nicename,attr,omitempty"`
+	Name     string `xml:",cdata"`
+}
+
+type wxrItem struct {
+	XMLName     xml.Name      `xml:"item"`
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	PubDate     string        `xml:"pubDate"`
+	Creator     wxrCDATA      `xml:"dc:creator"`
+	GUID        wxrGUID       `xml:"guid"`
+	Description string        `xml:"description"`
+	Content     wxrCDATA      `xml:"content:encoded"`
+	Excerpt     wxrCDATA      `xml:"excerpt:encoded"`
+	PostID      int           `xml:"wp:post_id"`
+	PostDate    wxrCDATA      `xml:"wp:post_date"`
+	PostDateGMT wxrCDATA      `xml:"wp:post_date_gmt"`
+	PostName    wxrCDATA      `xml:"wp:post_name"`
+	Status      wxrCDATA      `xml:"wp:status"`
+	PostType    wxrCDATA      `xml:"wp:post_type"`
+	Category    []wxrCategory `xml:"category"`
+}
+
+type wxrGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// writeHeader 频道信息只能写在第一个 item 之前
+func (x *WXR) writeHeader() error {
+	x.header = true
+	if _, err := io.WriteString(x.w, wxrHeader); err != nil {
+		return err
+	}
+	start := xml.StartElement{}
+	for _, el := range [][2]string{
+		{"title", x.opt.Title},
+		{"link", x.opt.Link},
+		{"description", ""},
+		{"pubDate", time.Now().Format(time.RFC1123Z)},
+		{"language", "zh-CN"},
+		{"wp:wxr_version", "1.2"},
+		{"wp:base_site_url", x.opt.Link},
+		{"wp:base_blog_url", x.opt.Link},
+	} {
+		start.Name.Local = el[0]
+		if err := x.enc.EncodeElement(el[1], start); err != nil {
+			return err
+		}
+	}
+	return x.enc.Flush()
+}
+
+func (x *WXR) Write(art *collect.Article) error {
+	if !x.header {
+		if err := x.writeHeader(); err != nil {
+			return err
+		}
+	}
+	art = RewriteImages(art, x.opt.ImageBaseURL)
+	item := wxrItem{
+		Title:    art.Title,
+		Link:     art.Href,
+		Creator:  wxrCDATA{art.AuthorName},
+		GUID:     wxrGUID{Value: art.Href},
+		Content:  wxrCDATA{art.Content},
+		Excerpt:  wxrCDATA{art.Intro},
+		PostID:   x.nextID,
+		PostName: wxrCDATA{art.Alias},
+		Status:   wxrCDATA{"publish"},
+		PostType: wxrCDATA{"post"},
+	}
+	x.nextID++
+	if !art.PostTime.IsZero() {
+		item.PubDate = art.PostTime.Format(time.RFC1123Z)
+		item.PostDate = wxrCDATA{art.PostTime.Format("2006-01-02 15:04:05")}
+		item.PostDateGMT = wxrCDATA{art.PostTime.UTC().Format("2006-01-02 15:04:05")}
+	}
+	if art.Cate.Name != "" {
+		item.Category = append(item.Category, wxrCategory{Domain: "category", Nicename: art.Cate.Alias, Name: art.Cate.Name})
+	}
+	for _, tg := range art.Tag {
+		if tg.Name == "" {
+			continue
+		}
+		item.Category = append(item.Category, wxrCategory{Domain: "post_tag", Nicename: tg.Tag, Name: tg.Name})
+	}
+	if err := x.enc.Encode(item); err != nil {
+		return err
+	}
+	return x.enc.Flush()
+}
+
+func (x *WXR) Close() error {
+	if !x.header {
+		if err := x.writeHeader(); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(x.w, wxrFooter)
+	return err
+}
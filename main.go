@@ -1,5 +1,325 @@
 package main
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/panel"
+	_ "github.com/cgghui/bt_site_cluster_collect/target/nbtimes_net"
+	_ "github.com/cgghui/bt_site_cluster_collect/target/techsir_com"
+	_ "github.com/cgghui/bt_site_cluster_collect/target/v2_sohu_com"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUsage = errors.New("usage")
+
+// command 子命令
+type command struct {
+	Usage string
+	Run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"list-sites":   {Usage: "list-sites", Run: runListSites},
+	"list-tags":    {Usage: "list-tags <site>", Run: runListTags},
+	"cluster":      {Usage: "cluster check|sites|sync [--inventory ./inventory.yaml] [--panel <name>] [--timeout 30s] [--write]", Run: runCluster},
+	"crawl":        {Usage: "crawl --site <site> --tag <tag> [--pages 1] [--detail=true] [--timeout 0] [--incremental] [--ledger ./ledger.jsonl] [--dedup] [--similarity 0.9] [--drop-duplicates] [--rate 0] [--min-delay 0] [--retries 3] [--retry-delay 500ms] [--thumbnails 320,640,1024] [--hash-images]", Run: runCrawl},
+	"crawl-all":    {Usage: "crawl-all [--sites a,b] [--pages 1] [--detail=true] [--timeout 0] [--concurrency 8] [--site-concurrency 2] [--thumbnails 320,640,1024] [--hash-images]", Run: runCrawlAll},
+	"detail":       {Usage: "detail --site <site> --href <href> [--timeout 0]", Run: runDetail},
+	"export":       {Usage: "export --format wxr|jsonl|markdown [--in -] [--out -] [--image-base-url <url>] [--title <title> --link <url>] [--jekyll]", Run: runExport},
+	"publish":      {Usage: "publish --site <site> [--in -] [--dir <dir>] [--http-url <url> --http-header 'Name: Value'] [--wp-url <url> --wp-user <user>]", Run: runPublish},
+	"site":         {Usage: "site [--in -] [--out ./site] [--theme <dir>] [--title <title>] [--url <url>] [--description <text>] [--page-size 20] [--site-root <dir> --panel-url <url> --panel-key-env BT_API_KEY --panel-insecure --panel-ca <file> --manifest <file> --image-config <file> --timeout 0]", Run: runSite},
+	"upload-queue": {Usage: "upload-queue add|list|flush|requeue|compact [--queue ./upload_queue.jsonl] [--panel <name>] [--site-root <dir> --in -] [--status pending|uploaded|failed] [--panel-url <url> --panel-key-env BT_API_KEY --panel-insecure --panel-ca <file> --force --timeout 0 --image-config <file> --inventory <file>]", Run: runUploadQueue},
+}
+
 func main() {
+	log.SetFlags(0)
+	log.SetPrefix("collect: ")
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if collect.PathExists(collect.SiteDefinitionPath) {
+		if _, err := collect.LoadSiteDefinitions(collect.SiteDefinitionPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := cmd.Run(ctx, os.Args[2:]); err != nil {
+		if errors.Is(err, ErrUsage) || errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "usage: collect %s\n", cmd.Usage)
+			os.Exit(2)
+		}
+		stop()
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage: collect <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  collect %s\n", commands[name].Usage)
+	}
+}
+
+// getStandard 按名称取得采集器，未注册时返回 ErrUndefinedSite
+func getStandard(site string) (collect.StandardContext, error) {
+	if site == "" {
+		return nil, ErrUsage
+	}
+	std := collect.GetStandardContext(site)
+	if std == nil {
+		return nil, fmt.Errorf("%w: %s", collect.ErrUndefinedSite, site)
+	}
+	return std, nil
+}
+
+// withTimeout timeout 为 0 时不设置期限
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func sortedTags(std collect.StandardContext) []collect.Tag {
+	tags := std.GetTag()
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	return tags
+}
+
+func runListSites(_ context.Context, args []string) error {
+	if len(args) != 0 {
+		return ErrUsage
+	}
+	names := collect.GetStandardName()
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func runListTags(_ context.Context, args []string) error {
+	if len(args) != 1 {
+		return ErrUsage
+	}
+	std, err := getStandard(args[0])
+	if err != nil {
+		return err
+	}
+	for _, tag := range sortedTags(std) {
+		fmt.Printf("%d\t%s\n", tag, tag)
+	}
+	return nil
+}
+
+func runCrawl(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("crawl", flag.ContinueOnError)
+	site := fs.String("site", "", "采集器名称")
+	tagName := fs.String("tag", "", "标签，英文名或数字，为空时采集全部标签")
+	pages := fs.Int("pages", 1, "每个标签采集的页数，增量采集时为最多页数，0 为不限")
+	detail := fs.Bool("detail", true, "是否采集文章详情")
+	timeout := fs.Duration("timeout", 0, "整个采集任务的期限，0 为不限")
+	incremental := fs.Bool("incremental", false, "增量采集，跳过已采集的文章，整页都已见过且已采集时停止翻页")
+	ledgerPath := fs.String("ledger", collect.LedgerPath, "增量采集的记录文件")
+	dedup := fs.Bool("dedup", false, "检测与已采集文章近似重复的文章")
+	dedupIndex := fs.String("dedup-index", collect.DuplicateIndexPath, "近似重复检测的指纹索引文件")
+	similarity := fs.Float64("similarity", collect.DefaultSimilarity, "判定近似重复的最低相似度，0-1")
+	dropDuplicates := fs.Bool("drop-duplicates", false, "不输出近似重复的文章，否则在 Duplicate 中标明来源")
+	rate := fs.Float64("rate", 0, "覆盖采集器的限速，每秒请求数")
+	minDelay := fs.Duration("min-delay", 0, "覆盖采集器的限速，相邻两次请求的最小间隔")
+	fs.IntVar(&collect.Retry.MaxAttempts, "retries", collect.Retry.MaxAttempts, "抓取失败时最多尝试的次数")
+	fs.DurationVar(&collect.Retry.BaseDelay, "retry-delay", collect.Retry.BaseDelay, "第一次重试前的等待时间，之后按指数增长")
+	thumbnailFlag(fs)
+	hashImagesFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *pages < 1 && !(*incremental && *pages == 0) {
+		return ErrUsage
+	}
+	std, err := getStandard(*site)
+	if err != nil {
+		return err
+	}
+	if *rate > 0 || *minDelay > 0 {
+		limit := collect.RateLimit{Rate: *rate, Burst: 1, MinDelay: *minDelay, MaxRetry: 2}
+		if err = collect.SetRateLimit(*site, limit); err != nil {
+			return fmt.Errorf("%s: %w", *site, err)
+		}
+	}
+	ctx, cancel := withTimeout(ctx, *timeout)
+	defer cancel()
+	tags := sortedTags(std)
+	if *tagName != "" {
+		var tag collect.Tag
+		if tag, err = collect.ParseTag(*tagName); err != nil {
+			return fmt.Errorf("%w: %s", err, *tagName)
+		}
+		tags = []collect.Tag{tag}
+	}
+	var ledger *collect.Ledger
+	if *incremental {
+		if ledger, err = collect.OpenLedger(*ledgerPath); err != nil {
+			return err
+		}
+		defer func() {
+			_ = ledger.Close()
+		}()
+	}
+	var index *collect.DuplicateIndex
+	if *dedup {
+		if index, err = collect.OpenDuplicateIndex(*dedupIndex, *similarity); err != nil {
+			return err
+		}
+		defer func() {
+			_ = index.Close()
+		}()
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	handle := func(art *collect.Article) error {
+		if *detail {
+			if err := std.ArticleDetailContext(ctx, art); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("%s %s: %v", *site, art.Href, err)
+				return nil
+			}
+		}
+		if index != nil {
+			match, err := index.Check(*site, art)
+			if err != nil {
+				return err
+			}
+			if art.Duplicate = match; match != nil {
+				log.Printf("%s %s: duplicate of %s %s (%.2f)", *site, art.Href, match.Site, match.Href, match.Similarity)
+			}
+		}
+		if art.Duplicate != nil && *dropDuplicates {
+			if ledger != nil {
+				return ledger.MarkProcessed(*site, art.Href)
+			}
+			return nil
+		}
+		if err := enc.Encode(art); err != nil {
+			return err
+		}
+		if ledger != nil {
+			return ledger.MarkProcessed(*site, art.Href)
+		}
+		return nil
+	}
+	for _, tag := range tags {
+		if *incremental {
+			if err = collect.IncrementalList(ctx, std, *site, ledger, tag, *pages, handle); err != nil {
+				return fmt.Errorf("%s %s: %w", *site, tag, err)
+			}
+			continue
+		}
+		for page := 1; page <= *pages; page++ {
+			var list []collect.Article
+			if list, err = std.ArticleListContext(ctx, tag, page); err != nil {
+				return fmt.Errorf("%s %s page %d: %w", *site, tag, page, err)
+			}
+			for i := range list {
+				if err = handle(&list[i]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func runDetail(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("detail", flag.ContinueOnError)
+	site := fs.String("site", "", "采集器名称")
+	href := fs.String("href", "", "文章链接")
+	timeout := fs.Duration("timeout", 0, "期限，0 为不限")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *href == "" {
+		return ErrUsage
+	}
+	std, err := getStandard(*site)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, *timeout)
+	defer cancel()
+	art := collect.Article{Href: *href}
+	if err = std.ArticleDetailContext(ctx, &art); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(art)
+}
+
+// panelTLSFlags 注册 -panel-insecure 与 -panel-ca 参数，宝塔面板默认使用自签名证书
+func panelTLSFlags(fs *flag.FlagSet) *panel.TLSConfig {
+	cfg := &panel.TLSConfig{}
+	fs.BoolVar(&cfg.Insecure, "panel-insecure", false, "不校验面板的 HTTPS 证书")
+	fs.StringVar(&cfg.CAFile, "panel-ca", "", "校验面板 HTTPS 证书使用的 CA 证书，PEM 格式")
+	return cfg
+}
+
+// newPanelClient 面板的接口客户端，密钥从环境变量 keyEnv 读取
+func newPanelClient(panelURL, keyEnv string, cfg *panel.TLSConfig) (*panel.Client, error) {
+	client := panel.NewClient(panelURL, os.Getenv(keyEnv))
+	var err error
+	if client.Client, err = cfg.HTTPClient(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// hashImagesFlag 注册 -hash-images 参数，设置 collect.ImageContentAddressed
+func hashImagesFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&collect.ImageContentAddressed, "hash-images", collect.ImageContentAddressed, "图片按内容的 SHA-256 保存到 /img/，相同的图片只保存一份")
+}
 
+// thumbnailFlag 注册 -thumbnails 参数，覆盖 collect.ThumbnailSizes
+func thumbnailFlag(fs *flag.FlagSet) {
+	fs.Func("thumbnails", "缩略图的宽度，以逗号分隔，默认 320,640,1024，为空时不生成", func(s string) error {
+		sizes := make([]int, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			w, err := strconv.Atoi(item)
+			if err != nil || w <= 0 {
+				return fmt.Errorf("invalid width: %s", item)
+			}
+			sizes = append(sizes, w)
+		}
+		collect.ThumbnailSizes = sizes
+		return nil
+	})
 }
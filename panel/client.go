@@ -0,0 +1,277 @@
+// Package panel 宝塔面板接口的客户端
+// 接口以 POST 表单调用，每个请求带上 request_time 与 request_token = md5(request_time + md5(密钥))
+package panel
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cgghui/cgghui"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrPanel = errors.New("panel error")
+var ErrUnexpectedStatus = errors.New("unexpected status")
+
+// ChunkSize 上传文件时每次发送的字节数
+var ChunkSize = 1 << 20
+
+// Client 宝塔面板接口的客户端，需要在面板的 API 接口设置中开启接口并将本机 IP 加入白名单
+type Client struct {
+	URL    string       // 面板地址，如：https://1.2.3.4:8888
+	Key    string       // 接口密钥
+	Client *http.Client // 为 nil 时使用 http.DefaultClient
+}
+
+func NewClient(panelURL, key string) *Client {
+	return &Client{URL: strings.TrimRight(panelURL, "/"), Key: key}
+}
+
+// TLSConfig 面板 HTTPS 证书的校验方式，宝塔面板默认使用自签名证书
+type TLSConfig struct {
+	Insecure bool   `json:"insecure,omitempty" yaml:"insecure,omitempty"` // 不校验证书
+	CAFile   string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`   // 校验面板证书使用的 CA 证书，PEM 格式
+}
+
+// HTTPClient 按 cfg 校验证书的客户端，cfg 为零值时返回 nil，即使用 http.DefaultClient
+func (cfg TLSConfig) HTTPClient() (*http.Client, error) {
+	if !cfg.Insecure && cfg.CAFile == "" {
+		return nil, nil
+	}
+	conf := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+	if cfg.CAFile != "" {
+		raw, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("%s: no certificate found", cfg.CAFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+	return &http.Client{Transport: transport}, nil
+}
+
+// Sign 接口签名 md5(requestTime + md5(key))
+func Sign(requestTime, key string) string {
+	return cgghui.MD5(requestTime + cgghui.MD5(key))
+}
+
+// form 带签名的表单
+func (c *Client) form() url.Values {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	return url.Values{"request_time": {now}, "request_token": {Sign(now, c.Key)}}
+}
+
+// Post 调用接口，path 如：/files?action=GetDir，返回响应的内容
+func (c *Client) Post(ctx context.Context, path string, form url.Values) ([]byte, error) {
+	body := c.form()
+	for k, v := range form {
+		body[k] = v
+	}
+	return c.do(ctx, path, strings.NewReader(body.Encode()), "application/x-www-form-urlencoded")
+}
+
+func (c *Client) do(ctx context.Context, path string, body io.Reader, contentType string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(c.URL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%w: %s %d", ErrUnexpectedStatus, path, resp.StatusCode)
+	}
+	if err = checkStatus(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// result 面板的通用响应
+type result struct {
+	Status *bool  `json:"status"`
+	Msg    string `json:"msg"`
+}
+
+// checkStatus 响应为 {"status": false, "msg": "..."} 时返回 ErrPanel
+func checkStatus(raw []byte) error {
+	var r result
+	if json.Unmarshal(raw, &r) == nil && r.Status != nil && !*r.Status {
+		return fmt.Errorf("%w: %s", ErrPanel, r.Msg)
+	}
+	return nil
+}
+
+// Upload 将 r 上传为服务器上的 dir/name，size 为文件大小，按 ChunkSize 分块发送
+// 面板返回的偏移与已发送的字节数不符、在全部发送前结束或拒绝上传时返回 ErrPanel
+func (c *Client) Upload(ctx context.Context, dir, name string, r io.Reader, size int64) error {
+	chunk := make([]byte, ChunkSize)
+	for start := int64(0); ; {
+		n, err := io.ReadFull(r, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+		if n == 0 && start < size {
+			return fmt.Errorf("upload %s/%s: %w after %d of %d bytes", dir, name, io.ErrUnexpectedEOF, start, size)
+		}
+		buf := &bytes.Buffer{}
+		mw := multipart.NewWriter(buf)
+		fields := c.form()
+		fields.Set("f_path", dir)
+		fields.Set("f_name", name)
+		fields.Set("f_size", strconv.FormatInt(size, 10))
+		fields.Set("f_start", strconv.FormatInt(start, 10))
+		for k := range fields {
+			if err = mw.WriteField(k, fields.Get(k)); err != nil {
+				return err
+			}
+		}
+		var fw io.Writer
+		if fw, err = mw.CreateFormFile("blob", name); err != nil {
+			return err
+		}
+		if _, err = fw.Write(chunk[:n]); err != nil {
+			return err
+		}
+		if err = mw.Close(); err != nil {
+			return err
+		}
+		var raw []byte
+		if raw, err = c.do(ctx, "/files?action=upload", buf, mw.FormDataContentType()); err != nil {
+			return err
+		}
+		start += int64(n)
+		// 未传完时面板返回下一块的起始位置，传完时返回 {"status": true}
+		reply := strings.TrimSpace(string(raw))
+		if next, err := strconv.ParseInt(reply, 10, 64); err == nil {
+			if next != start {
+				return fmt.Errorf("%w: upload %s/%s: expected offset %d, got %d", ErrPanel, dir, name, start, next)
+			}
+			if start >= size {
+				return nil
+			}
+			continue
+		}
+		var res result
+		if err = json.Unmarshal(raw, &res); err != nil || res.Status == nil || !*res.Status {
+			return fmt.Errorf("%w: upload %s/%s: unexpected reply %q", ErrPanel, dir, name, reply)
+		}
+		if start < size {
+			return fmt.Errorf("%w: upload %s/%s: finished after %d of %d bytes", ErrPanel, dir, name, start, size)
+		}
+		return nil
+	}
+}
+
+// UploadWithTimeout 与 bt.Session 的同名方法一致，将 fp 上传到服务器的 serverPath 目录，文件名取 name 的文件名部分
+// overwrite 为 false 且文件已存在时不上传
+func (c *Client) UploadWithTimeout(timeout time.Duration, name, serverPath string, fp *os.File, overwrite bool) error {
+	info, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if !overwrite {
+		var exists bool
+		if exists, err = c.Exists(ctx, serverPath, filepath.Base(name)); err != nil || exists {
+			return err
+		}
+	}
+	return c.Upload(ctx, serverPath, filepath.Base(name), fp, info.Size())
+}
+
+// FileInfo 面板目录列表中的一项
+type FileInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// dirList GetDir 的响应，每一项为 "名称;大小;修改时间;权限;所有者;..."
+type dirList struct {
+	Path  string   `json:"PATH"`
+	Dir   []string `json:"DIR"`
+	Files []string `json:"FILES"`
+}
+
+// List 列出服务器上 dir 目录中的文件与子目录，目录不存在时返回 ErrPanel
+func (c *Client) List(ctx context.Context, dir string) ([]FileInfo, error) {
+	raw, err := c.Post(ctx, "/files?action=GetDir", url.Values{"path": {dir}, "p": {"1"}, "showRow": {"10000"}})
+	if err != nil {
+		return nil, err
+	}
+	var list dirList
+	if err = json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("%w: GetDir %s: %v", ErrPanel, dir, err)
+	}
+	r := make([]FileInfo, 0, len(list.Dir)+len(list.Files))
+	for _, item := range list.Dir {
+		r = append(r, parseFileInfo(item, true))
+	}
+	for _, item := range list.Files {
+		r = append(r, parseFileInfo(item, false))
+	}
+	return r, nil
+}
+
+func parseFileInfo(item string, dir bool) FileInfo {
+	fields := strings.Split(item, ";")
+	info := FileInfo{Name: fields[0], IsDir: dir}
+	if len(fields) > 1 {
+		info.Size, _ = strconv.ParseInt(fields[1], 10, 64)
+	}
+	if len(fields) > 2 {
+		if sec, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			info.ModTime = time.Unix(sec, 0)
+		}
+	}
+	return info
+}
+
+// Exists 服务器上 dir 目录中是否存在文件 name，目录不存在时返回 false
+func (c *Client) Exists(ctx context.Context, dir, name string) (bool, error) {
+	list, err := c.List(ctx, dir)
+	if errors.Is(err, ErrPanel) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, info := range list {
+		if info.Name == name && !info.IsDir {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,187 @@
+package panel_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"github.com/cgghui/bt_site_cluster_collect/panel"
+	"github.com/cgghui/bt_site_cluster_collect/panel/paneltest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClientUpload(t *testing.T) {
+	srv := paneltest.NewServer(t, "secret")
+	chunk := panel.ChunkSize
+	panel.ChunkSize = 4
+	defer func() {
+		panel.ChunkSize = chunk
+	}()
+	client := srv.Client()
+	ctx := context.Background()
+	data := []byte("0123456789abc")
+	if err := client.Upload(ctx, "/www/wwwroot/a.com/img", "a.png", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if got, err := srv.ReadFile("/www/wwwroot/a.com/img/a.png"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("got %q error:%v", got, err)
+	}
+	if n := srv.Requests("upload"); n != 4 {
+		t.Fatalf("%d upload requests, want 4", n)
+	}
+	list, err := client.List(ctx, "/www/wwwroot/a.com")
+	if err != nil || len(list) != 1 || list[0].Name != "img" || !list[0].IsDir {
+		t.Fatalf("list=%+v error:%v", list, err)
+	}
+	if list, err = client.List(ctx, "/www/wwwroot/a.com/img"); err != nil || len(list) != 1 || list[0].Size != int64(len(data)) || list[0].ModTime.IsZero() {
+		t.Fatalf("list=%+v error:%v", list, err)
+	}
+	if _, err = client.List(ctx, "/www/wwwroot/missing"); !errors.Is(err, panel.ErrPanel) {
+		t.Fatalf("error:%v", err)
+	}
+
+	// overwrite 为 false 时已存在的文件不再上传
+	local := filepath.Join(t.TempDir(), "a.png")
+	if err = os.WriteFile(local, []byte("changed"), 0644); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	fp, err := os.Open(local)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+	if err = client.UploadWithTimeout(time.Minute, local, "/www/wwwroot/a.com/img", fp, false); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if got, _ := srv.ReadFile("/www/wwwroot/a.com/img/a.png"); !bytes.Equal(got, data) {
+		t.Fatalf("file overwritten: %q", got)
+	}
+	if err = client.UploadWithTimeout(time.Minute, local, "/www/wwwroot/a.com/img", fp, true); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if got, _ := srv.ReadFile("/www/wwwroot/a.com/img/a.png"); string(got) != "changed" {
+		t.Fatalf("file not overwritten: %q", got)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := paneltest.NewServer(t, "secret")
+	ctx := context.Background()
+	bad := panel.NewClient(srv.URL, "wrong")
+	if _, err := bad.List(ctx, "/"); !errors.Is(err, panel.ErrPanel) {
+		t.Fatalf("error:%v", err)
+	}
+	srv.FailNext("GetDir", 1)
+	if _, err := srv.Client().List(ctx, "/"); !errors.Is(err, panel.ErrUnexpectedStatus) {
+		t.Fatalf("error:%v", err)
+	}
+	if _, err := srv.Client().List(ctx, "/"); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+}
+
+func TestClientSites(t *testing.T) {
+	srv := paneltest.NewServer(t, "secret")
+	limit := panel.SiteListLimit
+	panel.SiteListLimit = 2
+	defer func() {
+		panel.SiteListLimit = limit
+	}()
+	ctx := context.Background()
+	info, err := srv.Client().SystemTotal(ctx)
+	if err != nil || info.Version == "" {
+		t.Fatalf("info=%+v error:%v", info, err)
+	}
+	for _, name := range []string{"a.com", "b.com", "c.com", "d.com"} {
+		srv.AddSite(name, "/www/wwwroot/"+name)
+	}
+	sites, err := srv.Client().Sites(ctx)
+	if err != nil || len(sites) != 4 || sites[3].Name != "d.com" || sites[3].Path != "/www/wwwroot/d.com" {
+		t.Fatalf("sites=%+v error:%v", sites, err)
+	}
+	if n := srv.Requests("getData"); n != 3 {
+		t.Fatalf("%d getData requests, want 3", n)
+	}
+}
+
+func TestClientUploadReply(t *testing.T) {
+	var replies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply := replies[0]
+		replies = replies[1:]
+		_, _ = w.Write([]byte(reply))
+	}))
+	defer srv.Close()
+	chunk := panel.ChunkSize
+	panel.ChunkSize = 4
+	defer func() {
+		panel.ChunkSize = chunk
+	}()
+	data := []byte("0123456789")
+	for _, tc := range []struct {
+		replies []string
+		ok      bool
+	}{
+		{[]string{"4", "8", `{"status":true,"msg":"上传成功"}`}, true},
+		{[]string{`{"status":false,"msg":"磁盘空间不足"}`}, false},
+		{[]string{"4", "<html>502 Bad Gateway</html>"}, false},
+		{[]string{"4", `{"msg":"ok"}`}, false},
+		{[]string{`{"status":true}`}, false},
+		{[]string{"4", "5"}, false},
+	} {
+		replies = tc.replies
+		err := panel.NewClient(srv.URL, "secret").Upload(context.Background(), "/www", "a.txt", bytes.NewReader(data), int64(len(data)))
+		if tc.ok && err != nil || !tc.ok && !errors.Is(err, panel.ErrPanel) {
+			t.Errorf("%q: error:%v", tc.replies, err)
+		}
+		if len(replies) != 0 {
+			t.Errorf("%q: %d replies left", tc.replies, len(replies))
+		}
+	}
+	// 数据比 size 短
+	replies = []string{"4", "8", "10"}
+	if err := panel.NewClient(srv.URL, "secret").Upload(context.Background(), "/www", "a.txt", bytes.NewReader(data), 20); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("error:%v", err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"system":"test","version":"7.7.0"}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	if _, err := panel.NewClient(srv.URL, "secret").SystemTotal(ctx); err == nil {
+		t.Fatal("expected certificate error")
+	}
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []panel.TLSConfig{{Insecure: true}, {CAFile: ca}} {
+		client := panel.NewClient(srv.URL, "secret")
+		var err error
+		if client.Client, err = cfg.HTTPClient(); err != nil {
+			t.Fatalf("%+v: error:%v", cfg, err)
+		}
+		if info, err := client.SystemTotal(ctx); err != nil || info.Version != "7.7.0" {
+			t.Fatalf("%+v: info=%+v error:%v", cfg, info, err)
+		}
+	}
+	if client, err := (panel.TLSConfig{}).HTTPClient(); client != nil || err != nil {
+		t.Fatalf("client=%v error:%v", client, err)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.pem")
+	_ = os.WriteFile(bad, []byte("not a certificate"), 0644)
+	if _, err := (panel.TLSConfig{CAFile: bad}).HTTPClient(); err == nil {
+		t.Fatal("expected error for invalid CA file")
+	}
+}
@@ -0,0 +1,241 @@
+// Package paneltest 用于测试的宝塔面板，实现 panel.Client 用到的接口，文件保存在临时目录
+//
+// 只实现以接口密钥签名（request_token）的接口，不实现 bt.Session 的登录会话接口；
+// 以 collect.Uploader 为参数的代码通过 panel.Client 连接本服务器测试
+package paneltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cgghui/bt_site_cluster_collect/panel"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Server 模拟的宝塔面板
+// 校验 request_token，支持 /files?action=upload 分块上传、/files?action=GetDir 列目录、
+// /system?action=GetSystemTotal 与 /data?action=getData 获取网站列表，
+// 服务器上的路径 /a/b 对应本地的 <Root>/a/b
+type Server struct {
+	URL  string
+	Key  string
+	Root string
+
+	mu       sync.Mutex
+	requests map[string]int
+	fail     map[string]int
+	sites    []panel.SiteInfo
+	srv      *httptest.Server
+}
+
+// NewServer 启动模拟的面板，测试结束后自动关闭
+func NewServer(t testing.TB, key string) *Server {
+	t.Helper()
+	s := &Server{Key: key, Root: t.TempDir(), requests: make(map[string]int), fail: make(map[string]int)}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = s.srv.URL
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+// Client 连接到该面板的客户端
+func (s *Server) Client() *panel.Client {
+	return panel.NewClient(s.URL, s.Key)
+}
+
+// FailNext 接下来 n 次 action 请求返回 500
+func (s *Server) FailNext(action string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail[action] = n
+}
+
+// AddSite 添加网站，getData 时返回
+func (s *Server) AddSite(name, root string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sites = append(s.sites, panel.SiteInfo{ID: len(s.sites) + 1, Name: name, Path: root, Status: "1"})
+}
+
+// Requests action 请求的次数，包括失败的
+func (s *Server) Requests(action string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[action]
+}
+
+// ReadFile 读取服务器上的文件
+func (s *Server) ReadFile(serverPath string) ([]byte, error) {
+	return os.ReadFile(s.local(serverPath))
+}
+
+// Files 服务器上 dir 目录下的全部文件，含子目录，按路径排序
+func (s *Server) Files(dir string) []string {
+	r := make([]string, 0)
+	root := s.local(dir)
+	_ = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(s.Root, p)
+			r = append(r, "/"+filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(r)
+	return r
+}
+
+// local 服务器路径对应的本地路径，path.Clean 保证不会超出 Root
+func (s *Server) local(serverPath string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(path.Clean("/"+serverPath)))
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	action := r.URL.Query().Get("action")
+	s.mu.Lock()
+	s.requests[action]++
+	fail := s.fail[action] > 0
+	if fail {
+		s.fail[action]--
+	}
+	s.mu.Unlock()
+	if fail {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		reply(w, false, err.Error())
+		return
+	}
+	requestTime := r.PostFormValue("request_time")
+	if requestTime == "" || r.PostFormValue("request_token") != panel.Sign(requestTime, s.Key) {
+		reply(w, false, "密钥校验失败")
+		return
+	}
+	switch r.URL.Path + "?" + action {
+	case "/files?upload":
+		s.upload(w, r)
+	case "/files?GetDir":
+		s.getDir(w, r)
+	case "/system?GetSystemTotal":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"system": "paneltest", "version": "7.7.0", "time": "1天", "cpuNum": 2, "memTotal": 2048})
+	case "/data?getData":
+		s.getData(w, r)
+	default:
+		reply(w, false, "不支持的接口")
+	}
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	size, err1 := strconv.ParseInt(r.PostFormValue("f_size"), 10, 64)
+	start, err2 := strconv.ParseInt(r.PostFormValue("f_start"), 10, 64)
+	name := r.PostFormValue("f_name")
+	if err1 != nil || err2 != nil || name == "" || strings.ContainsAny(name, "/\\") {
+		reply(w, false, "参数错误")
+		return
+	}
+	blob, _, err := r.FormFile("blob")
+	if err != nil {
+		reply(w, false, err.Error())
+		return
+	}
+	defer func() {
+		_ = blob.Close()
+	}()
+	target := filepath.Join(s.local(r.PostFormValue("f_path")), name)
+	// 分块先写入临时文件，全部收到后再替换
+	tmp := target + ".upload.tmp"
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		reply(w, false, err.Error())
+		return
+	}
+	flag := os.O_CREATE | os.O_WRONLY
+	if start == 0 {
+		flag |= os.O_TRUNC
+	}
+	fp, err := os.OpenFile(tmp, flag, 0644)
+	if err != nil {
+		reply(w, false, err.Error())
+		return
+	}
+	var n int64
+	if _, err = fp.Seek(start, io.SeekStart); err == nil {
+		n, err = io.Copy(fp, blob)
+	}
+	if closeErr := fp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		reply(w, false, err.Error())
+		return
+	}
+	if start+n < size {
+		_, _ = fmt.Fprint(w, start+n)
+		return
+	}
+	if err = os.Rename(tmp, target); err != nil {
+		reply(w, false, err.Error())
+		return
+	}
+	reply(w, true, "上传成功")
+}
+
+func (s *Server) getDir(w http.ResponseWriter, r *http.Request) {
+	dir := r.PostFormValue("path")
+	entries, err := os.ReadDir(s.local(dir))
+	if err != nil {
+		reply(w, false, "指定目录不存在")
+		return
+	}
+	dirs, files := make([]string, 0), make([]string, 0)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || strings.HasSuffix(e.Name(), ".upload.tmp") {
+			continue
+		}
+		item := fmt.Sprintf("%s;%d;%d;644;www;", e.Name(), info.Size(), info.ModTime().Unix())
+		if e.IsDir() {
+			dirs = append(dirs, item)
+		} else {
+			files = append(files, item)
+		}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"PATH": dir, "DIR": dirs, "FILES": files})
+}
+
+func (s *Server) getData(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue("table") != "sites" {
+		reply(w, false, "不支持的表")
+		return
+	}
+	limit, err1 := strconv.Atoi(r.PostFormValue("limit"))
+	p, err2 := strconv.Atoi(r.PostFormValue("p"))
+	if err1 != nil || err2 != nil || limit <= 0 || p <= 0 {
+		reply(w, false, "参数错误")
+		return
+	}
+	s.mu.Lock()
+	data := make([]panel.SiteInfo, 0)
+	for i := (p - 1) * limit; i < p*limit && i < len(s.sites); i++ {
+		data = append(data, s.sites[i])
+	}
+	s.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "page": ""})
+}
+
+func reply(w http.ResponseWriter, status bool, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "msg": msg})
+}
@@ -0,0 +1,72 @@
+package panel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// SiteListLimit 获取网站列表时每页的数量
+var SiteListLimit = 1000
+
+// SystemInfo GetSystemTotal 的响应中常用的字段
+type SystemInfo struct {
+	System   string `json:"system"`   // 操作系统
+	Version  string `json:"version"`  // 面板版本
+	Time     string `json:"time"`     // 已运行时间
+	CPUNum   int    `json:"cpuNum"`   // CPU 核数
+	MemTotal int    `json:"memTotal"` // 内存，MB
+}
+
+// SystemTotal 面板与服务器的基本信息，可用于检查接口是否可以访问、密钥是否正确
+func (c *Client) SystemTotal(ctx context.Context) (SystemInfo, error) {
+	var info SystemInfo
+	raw, err := c.Post(ctx, "/system?action=GetSystemTotal", nil)
+	if err != nil {
+		return info, err
+	}
+	if err = json.Unmarshal(raw, &info); err != nil {
+		return info, fmt.Errorf("%w: GetSystemTotal: %v", ErrPanel, err)
+	}
+	return info, nil
+}
+
+// SiteInfo 面板中的一个网站
+type SiteInfo struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`   // 主域名
+	Path   string `json:"path"`   // 根目录
+	Status string `json:"status"` // 1 为运行中，0 为已停止
+	PS     string `json:"ps"`     // 备注
+}
+
+// siteList getData 的响应
+type siteList struct {
+	Data []SiteInfo `json:"data"`
+}
+
+// Sites 面板中的全部网站
+func (c *Client) Sites(ctx context.Context) ([]SiteInfo, error) {
+	limit := SiteListLimit
+	if limit <= 0 {
+		limit = 1000
+	}
+	r := make([]SiteInfo, 0)
+	for p := 1; ; p++ {
+		form := url.Values{"table": {"sites"}, "limit": {strconv.Itoa(limit)}, "p": {strconv.Itoa(p)}}
+		raw, err := c.Post(ctx, "/data?action=getData", form)
+		if err != nil {
+			return nil, err
+		}
+		var list siteList
+		if err = json.Unmarshal(raw, &list); err != nil {
+			return nil, fmt.Errorf("%w: getData sites: %v", ErrPanel, err)
+		}
+		r = append(r, list.Data...)
+		if len(list.Data) < limit {
+			return r, nil
+		}
+	}
+}
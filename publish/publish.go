@@ -0,0 +1,128 @@
+// Package publish 将采集到的文章发布到各种目的地
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/cgghui"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var ErrUnexpectedStatus = errors.New("unexpected status")
+
+// Publisher 文章的发布目的地
+type Publisher interface {
+
+	// Publish 发布一篇文章，site 为采集器名称
+	Publish(ctx context.Context, site string, art *collect.Article) error
+}
+
+// Multi 依次发布到多个目的地，遇到错误即停止
+type Multi []Publisher
+
+func (m Multi) Publish(ctx context.Context, site string, art *collect.Article) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, site, art); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dir 将文章保存为本地目录中的 JSON 文件：<Root>/<site>/<md5(Href)>.json
+type Dir struct {
+	Root string
+}
+
+func (d Dir) Publish(ctx context.Context, site string, art *collect.Article) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if art.Href == "" {
+		return collect.ErrUndefinedArticleHref
+	}
+	raw, err := json.MarshalIndent(art, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(d.Root, site)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return collect.WriteFileAtomic(filepath.Join(dir, cgghui.MD5(art.Href)+".json"), raw)
+}
+
+// HTTP 以 JSON 形式 POST 到任意接口，请求体为 {"site": site, "article": art}
+type HTTP struct {
+	URL    string
+	Header http.Header  // 附加的请求头，如：Authorization
+	Client *http.Client // 为 nil 时使用 http.DefaultClient
+}
+
+// Payload HTTP 发布的请求体
+type Payload struct {
+	Site    string           `json:"site"`
+	Article *collect.Article `json:"article"`
+}
+
+func (h HTTP) Publish(ctx context.Context, site string, art *collect.Article) error {
+	return doJSON(ctx, h.Client, http.MethodPost, h.URL, h.Header, Payload{Site: site, Article: art}, nil)
+}
+
+// doJSON 发送 JSON 请求，非 2xx 时返回 ErrUnexpectedStatus；out 不为 nil 时解析响应
+func doJSON(ctx context.Context, client *http.Client, method, target string, header http.Header, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(in); err != nil {
+			return err
+		}
+		body = buf
+		header = header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	return do(ctx, client, method, target, header, body, out)
+}
+
+// do 发送请求，请求体的 Content-Type 由 header 指定，非 2xx 时返回 ErrUnexpectedStatus；out 不为 nil 时以 JSON 解析响应
+func do(ctx context.Context, client *http.Client, method, target string, header http.Header, body io.Reader, out interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	var resp *http.Response
+	if resp, err = client.Do(req); err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: %s %s: %d %s", ErrUnexpectedStatus, method, target, resp.StatusCode, msg)
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
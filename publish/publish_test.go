@@ -0,0 +1,182 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var article = collect.Article{
+	Title:    "电商平台发布商家扶持新规",
+	Content:  "<p>正文</p>",
+	Href:     "https://www.nbtimes.net/yaowen/1001.html",
+	PostTime: time.Date(2022, 4, 20, 10, 30, 0, 0, time.Local),
+	Tag:      []collect.ArticleTag{{Name: "电商", Tag: "dianshang"}, {Name: "新规", Tag: "xingui"}},
+	Cate:     collect.Category{Name: "要闻", Alias: "yaowen"},
+}
+
+func TestDir(t *testing.T) {
+	root := t.TempDir()
+	if err := (Dir{Root: root}).Publish(context.Background(), "nbtimes_net", &article); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(root, "nbtimes_net", "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("files=%v", files)
+	}
+	raw, _ := os.ReadFile(files[0])
+	var got collect.Article
+	if err := json.Unmarshal(raw, &got); err != nil || got.Title != article.Title {
+		t.Fatalf("got=%+v error:%v", got, err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	var got Payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	p := HTTP{URL: srv.URL, Header: http.Header{"X-Token": {"secret"}}}
+	if err := p.Publish(context.Background(), "nbtimes_net", &article); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if got.Site != "nbtimes_net" || got.Article.Href != article.Href {
+		t.Fatalf("got=%+v", got)
+	}
+	p.Header = nil
+	if err := p.Publish(context.Background(), "nbtimes_net", &article); !errors.Is(err, ErrUnexpectedStatus) {
+		t.Fatalf("error:%v", err)
+	}
+}
+
+// fakeWordPress 模拟 WordPress REST API 的 posts、tags、categories、media
+type fakeWordPress struct {
+	mu    sync.Mutex
+	next  int
+	terms map[string][]wpTerm
+	posts []map[string]interface{}
+	media map[string][]byte // 文件名 -> 内容
+}
+
+func (f *fakeWordPress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "app password" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	kind := filepath.Base(r.URL.Path)
+	switch {
+	case r.Method == http.MethodGet && (kind == "tags" || kind == "categories"):
+		found := make([]wpTerm, 0)
+		for _, t := range f.terms[kind] {
+			if t.Name == r.URL.Query().Get("search") {
+				found = append(found, t)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(found)
+	case r.Method == http.MethodPost && (kind == "tags" || kind == "categories"):
+		var t wpTerm
+		_ = json.NewDecoder(r.Body).Decode(&t)
+		f.next++
+		t.ID = f.next
+		f.terms[kind] = append(f.terms[kind], t)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(t)
+	case r.Method == http.MethodPost && kind == "media":
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition"))
+		raw, _ := io.ReadAll(r.Body)
+		if err != nil || params["filename"] == "" || !strings.HasPrefix(r.Header.Get("Content-Type"), "image/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.next++
+		f.media[params["filename"]] = raw
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(wpMedia{ID: f.next, SourceURL: "http://" + r.Host + "/wp-content/uploads/" + params["filename"]})
+	case r.Method == http.MethodPost && kind == "posts":
+		post := make(map[string]interface{})
+		_ = json.NewDecoder(r.Body).Decode(&post)
+		f.next++
+		f.posts = append(f.posts, post)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": f.next, "title": map[string]string{"rendered": post["title"].(string)}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestWordPress(t *testing.T) {
+	fake := &fakeWordPress{terms: map[string][]wpTerm{"tags": {{ID: 100, Name: "电商", Slug: "dianshang"}}}, media: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	root := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(root, "img"), 0755)
+	for _, name := range []string{"a.jpg", "a-320w.jpg"} {
+		if err := os.WriteFile(filepath.Join(root, "img", name), []byte("\xFF\xD8\xFF"+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	art := article
+	art.Content = `<p>正文</p><img src="/img/a.jpg" srcset="/img/a-320w.jpg 320w, /img/a.jpg 1200w"/>`
+	art.LocalImages = []string{"/img/a.jpg", "/img/a-320w.jpg"}
+	art.Cover = "/img/a.jpg"
+	wp := &WordPress{BaseURL: srv.URL + "/", Username: "admin", Password: "app password", Status: "draft", ImageRoot: root}
+	for i := 0; i < 2; i++ {
+		if err := wp.Publish(context.Background(), "nbtimes_net", &art); err != nil {
+			t.Fatalf("error:%v", err)
+		}
+	}
+	if len(fake.posts) != 2 || len(fake.terms["tags"]) != 2 || len(fake.terms["categories"]) != 1 {
+		t.Fatalf("posts=%v terms=%v", fake.posts, fake.terms)
+	}
+	post := fake.posts[1]
+	if post["status"] != "draft" || post["date"] != "2022-04-20T10:30:00" {
+		t.Fatalf("post=%v", post)
+	}
+	if tags := post["tags"].([]interface{}); len(tags) != 2 || tags[0].(float64) != 100 {
+		t.Fatalf("tags=%v", tags)
+	}
+	// 图片只上传一次，正文中的地址改为媒体库中的地址，封面为特色图片
+	uploads := srv.URL + "/wp-content/uploads/"
+	want := `<p>正文</p><img src="` + uploads + `a.jpg" srcset="` + uploads + `a-320w.jpg 320w, ` + uploads + `a.jpg 1200w"/>`
+	if len(fake.media) != 2 || string(fake.media["a.jpg"]) != "\xFF\xD8\xFFa.jpg" || post["content"] != want {
+		t.Fatalf("media=%d content=%v", len(fake.media), post["content"])
+	}
+	if post["featured_media"] != fake.posts[0]["featured_media"] || wp.media["/img/a.jpg"].ID != int(post["featured_media"].(float64)) {
+		t.Fatalf("featured_media=%v media=%v", post["featured_media"], wp.media)
+	}
+	if art.Content == want {
+		t.Fatal("original article modified")
+	}
+	missing := art
+	missing.LocalImages = []string{"/img/missing.jpg"}
+	if err := wp.Publish(context.Background(), "nbtimes_net", &missing); !errors.Is(err, os.ErrNotExist) || len(fake.posts) != 2 {
+		t.Fatalf("posts=%d error:%v", len(fake.posts), err)
+	}
+	wp.Password = "wrong"
+	wp.terms = nil
+	if err := wp.Publish(context.Background(), "nbtimes_net", &article); !errors.Is(err, ErrUnexpectedStatus) {
+		t.Fatalf("error:%v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/export"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// WordPress 通过 REST API 发布文章，使用应用密码（Application Passwords）认证
+// 标签与分类按名称查找，不存在时自动创建；
+// LocalImages 中的图片上传到媒体库，正文与封面的地址改为媒体库中的地址，封面设为特色图片
+type WordPress struct {
+	BaseURL   string       // 站点地址，如：https://example.com
+	Username  string       // 用户名
+	Password  string       // 应用密码
+	Status    string       // 文章状态，默认 publish，可选 draft、pending
+	ImageRoot string       // LocalImages 所在的本地目录，为空时使用 collect.ImgRootPath
+	Client    *http.Client // 为 nil 时使用 http.DefaultClient
+
+	mu    sync.Mutex
+	terms map[string]int     // "tags/名称" -> ID
+	media map[string]wpMedia // 本地图片路径 -> 已上传的媒体，同一图片只上传一次
+}
+
+// wpTerm 标签或分类
+type wpTerm struct {
+	ID          int    `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// wpMedia 媒体库中的文件
+type wpMedia struct {
+	ID        int    `json:"id"`
+	SourceURL string `json:"source_url"`
+}
+
+// wpPost 文章
+type wpPost struct {
+	Title         string `json:"title"`
+	Content       string `json:"content"`
+	Excerpt       string `json:"excerpt,omitempty"`
+	Slug          string `json:"slug,omitempty"`
+	Status        string `json:"status"`
+	Date          string `json:"date,omitempty"`
+	Tags          []int  `json:"tags,omitempty"`
+	Categories    []int  `json:"categories,omitempty"`
+	FeaturedMedia int    `json:"featured_media,omitempty"`
+}
+
+func (w *WordPress) endpoint(path string) string {
+	return strings.TrimRight(w.BaseURL, "/") + "/wp-json/wp/v2/" + path
+}
+
+func (w *WordPress) header() http.Header {
+	req := &http.Request{Header: make(http.Header)}
+	req.SetBasicAuth(w.Username, w.Password)
+	return req.Header
+}
+
+// term 按名称取得标签或分类的 ID，不存在时创建；kind 为 tags 或 categories
+func (w *WordPress) term(ctx context.Context, kind string, t wpTerm) (int, error) {
+	key := kind + "/" + t.Name
+	w.mu.Lock()
+	if id, ok := w.terms[key]; ok {
+		w.mu.Unlock()
+		return id, nil
+	}
+	w.mu.Unlock()
+	var found []wpTerm
+	q := url.Values{"search": {t.Name}, "per_page": {"100"}}
+	if err := doJSON(ctx, w.Client, http.MethodGet, w.endpoint(kind)+"?"+q.Encode(), w.header(), nil, &found); err != nil {
+		return 0, err
+	}
+	id := 0
+	for _, f := range found {
+		if f.Name == t.Name {
+			id = f.ID
+			break
+		}
+	}
+	if id == 0 {
+		var created wpTerm
+		if err := doJSON(ctx, w.Client, http.MethodPost, w.endpoint(kind), w.header(), t, &created); err != nil {
+			return 0, err
+		}
+		id = created.ID
+	}
+	w.mu.Lock()
+	if w.terms == nil {
+		w.terms = make(map[string]int)
+	}
+	w.terms[key] = id
+	w.mu.Unlock()
+	return id, nil
+}
+
+// upload 将本地图片 imgPath 上传到媒体库，已上传过的直接返回
+func (w *WordPress) upload(ctx context.Context, imgPath string) (wpMedia, error) {
+	w.mu.Lock()
+	if m, ok := w.media[imgPath]; ok {
+		w.mu.Unlock()
+		return m, nil
+	}
+	w.mu.Unlock()
+	root := w.ImageRoot
+	if root == "" {
+		root = collect.ImgRootPath
+	}
+	name, err := collect.SafeJoin(root, imgPath)
+	if err != nil {
+		return wpMedia{}, err
+	}
+	var raw []byte
+	if raw, err = os.ReadFile(name); err != nil {
+		return wpMedia{}, err
+	}
+	header := w.header()
+	contentType := mime.TypeByExtension(path.Ext(imgPath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(imgPath)}))
+	var m wpMedia
+	if err = do(ctx, w.Client, http.MethodPost, w.endpoint("media"), header, bytes.NewReader(raw), &m); err != nil {
+		return m, err
+	}
+	if m.ID == 0 || m.SourceURL == "" {
+		return m, fmt.Errorf("%w: %s: missing media id or source_url", ErrUnexpectedStatus, w.endpoint("media"))
+	}
+	w.mu.Lock()
+	if w.media == nil {
+		w.media = make(map[string]wpMedia)
+	}
+	w.media[imgPath] = m
+	w.mu.Unlock()
+	return m, nil
+}
+
+func (w *WordPress) Publish(ctx context.Context, _ string, art *collect.Article) error {
+	// 先上传图片，正文中的本地地址改为媒体库中的地址
+	urls := make(map[string]string, len(art.LocalImages))
+	featured := 0
+	for _, p := range art.LocalImages {
+		m, err := w.upload(ctx, p)
+		if err != nil {
+			return err
+		}
+		urls[p] = m.SourceURL
+		if p == art.Cover {
+			featured = m.ID
+		}
+	}
+	if art.Cover != "" && featured == 0 {
+		m, err := w.upload(ctx, art.Cover)
+		if err != nil {
+			return err
+		}
+		urls[art.Cover], featured = m.SourceURL, m.ID
+	}
+	art = export.ReplaceImages(art, urls)
+	post := wpPost{
+		Title:         art.Title,
+		Content:       art.Content,
+		Excerpt:       art.Intro,
+		Slug:          art.Alias,
+		Status:        w.Status,
+		FeaturedMedia: featured,
+	}
+	if post.Status == "" {
+		post.Status = "publish"
+	}
+	if !art.PostTime.IsZero() {
+		post.Date = art.PostTime.Format("2006-01-02T15:04:05")
+	}
+	for _, tg := range art.Tag {
+		if tg.Name == "" {
+			continue
+		}
+		id, err := w.term(ctx, "tags", wpTerm{Name: tg.Name, Slug: tg.Tag})
+		if err != nil {
+			return err
+		}
+		post.Tags = append(post.Tags, id)
+	}
+	if art.Cate.Name != "" {
+		id, err := w.term(ctx, "categories", wpTerm{Name: art.Cate.Name, Slug: art.Cate.Alias, Description: art.Cate.Intro})
+		if err != nil {
+			return err
+		}
+		post.Categories = append(post.Categories, id)
+	}
+	// 响应中的 title、content 是对象，只取 ID
+	var created struct {
+		ID int `json:"id"`
+	}
+	if err := doJSON(ctx, w.Client, http.MethodPost, w.endpoint("posts"), w.header(), post, &created); err != nil {
+		return err
+	}
+	if created.ID == 0 {
+		return fmt.Errorf("%w: %s: missing post id", ErrUnexpectedStatus, w.endpoint("posts"))
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package sitegen
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/cgghui"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Deployer 将 Build 的输出与文章的图片上传到站点
+// 每个文件上传后在 Manifest 中记录内容的 SHA-256，之后只上传内容有变化的文件
+type Deployer struct {
+	Dir      string // Build 的输出目录
+	SiteRoot string // 站点在服务器上的根目录，如：/www/wwwroot/example.com
+	Manifest string // 已上传文件的记录，为空时为 <Dir>/.deploy/<md5(SiteRoot)>.json
+}
+
+// DeployResult Deploy 的结果
+type DeployResult struct {
+	Uploaded int // 本次上传的文件数
+	Skipped  int // 与上次上传时内容相同、未上传的文件数
+}
+
+func (d Deployer) manifestPath() string {
+	if d.Manifest != "" {
+		return d.Manifest
+	}
+	return filepath.Join(d.Dir, ".deploy", cgghui.MD5(d.SiteRoot)+".json")
+}
+
+// Deploy 先上传 images 中的图片，再上传 Dir 中的全部文件，以 . 开头的文件与目录除外
+// images 为相对 collect.ImgRootPath 的路径，同 Article.LocalImages，经 collect.UploadImage 上传，因此会应用站点的图片处理；
+// 站点的图片处理配置变化时图片会重新上传。遇到错误即停止，已上传的文件仍会记录
+func (d Deployer) Deploy(ctx context.Context, u collect.Uploader, images []string) (res DeployResult, err error) {
+	manifest := make(map[string]string)
+	if raw, err := os.ReadFile(d.manifestPath()); err == nil {
+		if err = json.Unmarshal(raw, &manifest); err != nil {
+			return res, err
+		}
+	} else if !os.IsNotExist(err) {
+		return res, err
+	}
+	defer func() {
+		if res.Uploaded == 0 {
+			return
+		}
+		raw, mErr := json.MarshalIndent(manifest, "", "  ")
+		if mErr == nil {
+			if mErr = os.MkdirAll(filepath.Dir(d.manifestPath()), 0755); mErr == nil {
+				mErr = collect.WriteFileAtomic(d.manifestPath(), raw)
+			}
+		}
+		if err == nil {
+			err = mErr
+		}
+	}()
+	// 图片的记录中带上站点的图片处理配置，配置变化后重新上传
+	procSum := ""
+	if proc, ok := collect.GetImageProcess(d.SiteRoot); ok {
+		raw, _ := json.Marshal(proc)
+		procSum = ":" + cgghui.MD5(string(raw))
+	}
+	seen := make(map[string]bool)
+	for _, p := range images {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if err = ctx.Err(); err != nil {
+			return res, err
+		}
+		var local, sum string
+		if local, err = collect.SafeJoin(collect.ImgRootPath, p); err != nil {
+			return res, err
+		}
+		if sum, err = fileSum(local); err != nil {
+			return res, err
+		}
+		sum += procSum
+		if manifest[p] == sum {
+			res.Skipped++
+			continue
+		}
+		if err = collect.UploadImage(u, d.SiteRoot, p); err != nil {
+			return res, err
+		}
+		manifest[p] = sum
+		res.Uploaded++
+	}
+	files := make([]string, 0)
+	err = filepath.WalkDir(d.Dir, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(e.Name(), ".") && p != d.Dir {
+			if e.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !e.IsDir() {
+			rel, err := filepath.Rel(d.Dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, "/"+filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	sort.Strings(files)
+	for _, p := range files {
+		if err = ctx.Err(); err != nil {
+			return res, err
+		}
+		local := filepath.Join(d.Dir, filepath.FromSlash(p))
+		var sum string
+		if sum, err = fileSum(local); err != nil {
+			return res, err
+		}
+		if manifest[p] == sum {
+			res.Skipped++
+			continue
+		}
+		if err = uploadFile(u, local, d.SiteRoot, p); err != nil {
+			return res, err
+		}
+		manifest[p] = sum
+		res.Uploaded++
+	}
+	return res, nil
+}
+
+// uploadFile 将本地文件 local 上传为站点中的 p，与 collect.UploadImage 相同，路径经过 SafeJoin
+func uploadFile(u collect.Uploader, local, siteRoot, p string) error {
+	serverPath, err := collect.SafeJoin(siteRoot, p)
+	if err != nil {
+		return err
+	}
+	var fp *os.File
+	if fp, err = os.Open(local); err != nil {
+		return err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+	return u.UploadWithTimeout(collect.UploadTimeout, local, path.Dir(serverPath), fp, true)
+}
+
+func fileSum(name string) (string, error) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
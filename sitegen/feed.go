@@ -0,0 +1,262 @@
+package sitegen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/export"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 站点地图与订阅的路径，Site.URL 为空时不生成
+const (
+	SitemapPath = "/sitemap.xml" // 网址超过 SitemapMaxURLs 时为索引，各分片为 /sitemap-<n>.xml
+	RSSPath     = "/rss.xml"
+	AtomPath    = "/atom.xml"
+)
+
+// SitemapMaxURLs 每个站点地图文件的最大网址数，搜索引擎的限制为 50000
+var SitemapMaxURLs = 50000
+
+// FeedSize RSS 与 Atom 中的文章数，取最新的
+var FeedSize = 20
+
+const sitemapXmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// sitemapURL 站点地图中的一个网址，也用于索引中的一个分片
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Category    []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string         `xml:"title"`
+	ID        string         `xml:"id"`
+	Updated   string         `xml:"updated"`
+	Published string         `xml:"published,omitempty"`
+	Link      atomLink       `xml:"link"`
+	Author    *atomPerson    `xml:"author,omitempty"`
+	Category  []atomCategory `xml:"category"`
+	Summary   string         `xml:"summary,omitempty"`
+	Content   atomText       `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// pageInfo 生成的一个页面，用于站点地图
+type pageInfo struct {
+	Path    string
+	LastMod time.Time
+}
+
+// encodeXML 带 XML 声明的缩进格式
+func encodeXML(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// w3cTime 站点地图与 Atom 使用的时间格式，零值时为空字符串
+func w3cTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// sitemap 生成站点地图，网址按路径排序，lastmod 为页面中最新文章的 PostTime
+// 不超过 SitemapMaxURLs 时只有 /sitemap.xml，否则 /sitemap.xml 为索引，分片为 /sitemap-1.xml、/sitemap-2.xml……
+func (g *Generator) sitemap(pages []pageInfo) (map[string][]byte, error) {
+	pages = append([]pageInfo(nil), pages...)
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Path < pages[j].Path
+	})
+	urls := make([]sitemapURL, 0, len(pages))
+	for _, p := range pages {
+		urls = append(urls, sitemapURL{Loc: g.Site.AbsURL(p.Path), LastMod: w3cTime(p.LastMod)})
+	}
+	files := make(map[string][]byte)
+	limit := SitemapMaxURLs
+	if limit <= 0 || len(urls) <= limit {
+		raw, err := encodeXML(sitemapURLSet{Xmlns: sitemapXmlns, URLs: urls})
+		if err != nil {
+			return nil, err
+		}
+		files[SitemapPath] = raw
+		return files, nil
+	}
+	index := sitemapIndex{Xmlns: sitemapXmlns}
+	for n := 1; (n-1)*limit < len(urls); n++ {
+		start, end := (n-1)*limit, n*limit
+		if end > len(urls) {
+			end = len(urls)
+		}
+		var lastMod time.Time
+		for _, p := range pages[start:end] {
+			if p.LastMod.After(lastMod) {
+				lastMod = p.LastMod
+			}
+		}
+		raw, err := encodeXML(sitemapURLSet{Xmlns: sitemapXmlns, URLs: urls[start:end]})
+		if err != nil {
+			return nil, err
+		}
+		name := "/sitemap-" + strconv.Itoa(n) + ".xml"
+		files[name] = raw
+		index.Sitemaps = append(index.Sitemaps, sitemapURL{Loc: g.Site.AbsURL(name), LastMod: w3cTime(lastMod)})
+	}
+	raw, err := encodeXML(index)
+	if err != nil {
+		return nil, err
+	}
+	files[SitemapPath] = raw
+	return files, nil
+}
+
+// feeds 生成 RSS 2.0 与 Atom，arts 已按发布时间从新到旧排序
+// 正文中的图片改写为完整地址；更新时间取最新文章的 PostTime，因此文章不变时内容不变
+func (g *Generator) feeds(arts []*collect.Article) (map[string][]byte, error) {
+	if FeedSize > 0 && len(arts) > FeedSize {
+		arts = arts[:FeedSize]
+	}
+	var updated time.Time
+	for _, art := range arts {
+		if art.PostTime.After(updated) {
+			updated = art.PostTime
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Unix(0, 0).UTC()
+	}
+	home := g.Site.AbsURL("/")
+	rss := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:         g.Site.Title,
+		Link:          home,
+		Description:   g.Site.Description,
+		Language:      "zh-CN",
+		LastBuildDate: updated.Format(time.RFC1123Z),
+	}}
+	atom := atomFeed{
+		Title:   g.Site.Title,
+		ID:      home,
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: g.Site.AbsURL(AtomPath), Rel: "self", Type: "application/atom+xml"},
+			{Href: home, Rel: "alternate", Type: "text/html"},
+		},
+		Author: atomPerson{Name: g.Site.Title},
+	}
+	for _, art := range arts {
+		link := g.Site.AbsURL(ArticlePath(art))
+		content := export.RewriteImages(art, g.Site.URL).Content
+		item := rssItem{Title: art.Title, Link: link, GUID: rssGUID{IsPermaLink: true, Value: link}, Description: content}
+		entry := atomEntry{
+			Title:   art.Title,
+			ID:      link,
+			Updated: updated.Format(time.RFC3339),
+			Link:    atomLink{Href: link, Rel: "alternate", Type: "text/html"},
+			Summary: art.Intro,
+			Content: atomText{Type: "html", Value: content},
+		}
+		if !art.PostTime.IsZero() {
+			item.PubDate = art.PostTime.Format(time.RFC1123Z)
+			entry.Updated, entry.Published = w3cTime(art.PostTime), w3cTime(art.PostTime)
+		}
+		if art.AuthorName != "" {
+			entry.Author = &atomPerson{Name: art.AuthorName}
+		}
+		for _, tg := range art.Tag {
+			if tg.Name != "" {
+				item.Category = append(item.Category, tg.Name)
+				entry.Category = append(entry.Category, atomCategory{Term: tg.Name})
+			}
+		}
+		rss.Channel.Items = append(rss.Channel.Items, item)
+		atom.Entries = append(atom.Entries, entry)
+	}
+	files := make(map[string][]byte)
+	var err error
+	if files[RSSPath], err = encodeXML(rss); err != nil {
+		return nil, err
+	}
+	if files[AtomPath], err = encodeXML(atom); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
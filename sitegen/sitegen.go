@@ -0,0 +1,315 @@
+// Package sitegen 用 html/template 主题将采集到的文章生成静态站点，并上传到宝塔面板的站点
+// 生成的页面：首页 /index.html、文章页 /article/<slug>.html、标签页 /tag/<ArticleTag.Tag>/、分类页 /category/<Category.Alias>/，
+// 列表页第 2 页起为同目录下的 <n>.html，首页为 /page/<n>.html
+// 设置了站点地址时还生成站点地图 /sitemap.xml 与订阅 /rss.xml、/atom.xml，与页面一起由 Deployer 上传
+package sitegen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/export"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultPageSize 列表页每页的文章数
+const DefaultPageSize = 20
+
+// Site 站点的信息
+type Site struct {
+	Title       string // 站点名称
+	URL         string // 站点地址，如：https://www.example.com，为空时页面中只使用相对站点根目录的路径
+	Description string // 站点描述
+}
+
+// AbsURL p 的完整地址，URL 为空时返回 p
+func (s Site) AbsURL(p string) string {
+	if s.URL == "" {
+		return p
+	}
+	return strings.TrimRight(s.URL, "/") + p
+}
+
+// Page 执行模板时的数据
+type Page struct {
+	Site     Site
+	Title    string             // 页面标题，首页为空
+	URL      string             // 本页的路径
+	Article  *collect.Article   // 文章页的文章
+	Articles []*collect.Article // 列表页的文章，按发布时间从新到旧
+	Tag      collect.ArticleTag // 标签页的标签
+	Category collect.Category   // 分类页的分类
+	Page     int                // 列表页的页码，从 1 开始
+	Pages    int                // 列表页的总页数
+	PrevURL  string             // 上一页，第一页时为空
+	NextURL  string             // 下一页，最后一页时为空
+}
+
+// slug 将 s 转换为可以作为路径中一段的字符串，无法转换时返回空字符串
+func slug(s string) string {
+	p, err := collect.SafePath(strings.ReplaceAll(strings.TrimSpace(s), "/", "-"))
+	if err != nil || p == "/" {
+		return ""
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// ArticlePath 文章页的路径，slug 同 export.Slug
+func ArticlePath(art *collect.Article) string {
+	return "/article/" + slug(export.Slug(art)) + ".html"
+}
+
+// listPath 列表页的路径，dir 为第一页的目录，如：/tag/x/
+func listPath(dir string, page int) string {
+	if page <= 1 {
+		return dir
+	}
+	return dir + strconv.Itoa(page) + ".html"
+}
+
+// IndexPath 首页第 page 页的路径
+func IndexPath(page int) string {
+	if page <= 1 {
+		return "/"
+	}
+	return "/page/" + strconv.Itoa(page) + ".html"
+}
+
+// TagPath 标签页第 page 页的路径，tag 为 ArticleTag.Tag，为空时返回空字符串
+func TagPath(tag string, page int) string {
+	if s := slug(tag); s != "" {
+		return listPath("/tag/"+s+"/", page)
+	}
+	return ""
+}
+
+// CategoryPath 分类页第 page 页的路径，alias 为 Category.Alias，为空时返回空字符串
+func CategoryPath(alias string, page int) string {
+	if s := slug(alias); s != "" {
+		return listPath("/category/"+s+"/", page)
+	}
+	return ""
+}
+
+// FilePath 页面路径对应的文件，以 / 结尾时为其中的 index.html
+func FilePath(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return p + "index.html"
+	}
+	return p
+}
+
+// Generator 静态站点生成器
+type Generator struct {
+	Site     Site
+	Theme    *Theme // 为 nil 时使用 DefaultTheme
+	Dir      string // 输出目录
+	PageSize int    // 列表页每页的文章数，<= 0 时为 DefaultPageSize
+}
+
+// BuildResult Build 的结果，路径均为相对输出目录、以 / 开头的文件路径
+type BuildResult struct {
+	Written   []string // 新生成或内容有变化的文件
+	Unchanged int      // 内容没有变化、未重写的文件数
+}
+
+// Build 生成全部页面并写入 Dir，内容没有变化的文件不会重写，因此修改时间不变
+// arts 中 ArticlePath 相同的文章以后出现的为准
+func (g *Generator) Build(ctx context.Context, arts []*collect.Article) (BuildResult, error) {
+	var res BuildResult
+	files, err := g.Render(arts)
+	if err != nil {
+		return res, err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = ctx.Err(); err != nil {
+			return res, err
+		}
+		local := filepath.Join(g.Dir, filepath.FromSlash(name))
+		if old, err := os.ReadFile(local); err == nil && bytes.Equal(old, files[name]) {
+			res.Unchanged++
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+			return res, err
+		}
+		if err = collect.WriteFileAtomic(local, files[name]); err != nil {
+			return res, err
+		}
+		res.Written = append(res.Written, name)
+	}
+	return res, nil
+}
+
+// Render 生成全部页面与主题的静态文件，Site.URL 不为空时还生成站点地图、RSS 与 Atom，返回 文件路径 -> 内容
+func (g *Generator) Render(arts []*collect.Article) (map[string][]byte, error) {
+	theme := g.Theme
+	if theme == nil {
+		theme = DefaultTheme()
+	}
+	arts = SortArticles(arts)
+	files := make(map[string][]byte)
+	pages := make([]pageInfo, 0)
+	render := func(name string, page Page) error {
+		buf := &bytes.Buffer{}
+		if err := theme.tmpl.ExecuteTemplate(buf, name, page); err != nil {
+			return err
+		}
+		files[FilePath(page.URL)] = buf.Bytes()
+		info := pageInfo{Path: page.URL}
+		if page.Article != nil {
+			info.LastMod = page.Article.PostTime
+		}
+		for _, art := range page.Articles {
+			if art.PostTime.After(info.LastMod) {
+				info.LastMod = art.PostTime
+			}
+		}
+		pages = append(pages, info)
+		return nil
+	}
+	for _, art := range arts {
+		if err := render(TemplateArticle, Page{Site: g.Site, Title: art.Title, URL: ArticlePath(art), Article: art}); err != nil {
+			return nil, err
+		}
+	}
+	// 首页
+	for _, page := range g.paginate(arts, IndexPath) {
+		if err := render(TemplateIndex, page); err != nil {
+			return nil, err
+		}
+	}
+	// 标签页与分类页
+	tags, tagArts := make(map[string]collect.ArticleTag), make(map[string][]*collect.Article)
+	cates, cateArts := make(map[string]collect.Category), make(map[string][]*collect.Article)
+	for _, art := range arts {
+		seen := make(map[string]bool)
+		for _, tg := range art.Tag {
+			s := slug(tg.Tag)
+			if s == "" || seen[s] {
+				continue
+			}
+			seen[s] = true
+			if _, ok := tags[s]; !ok {
+				tags[s] = tg
+			}
+			tagArts[s] = append(tagArts[s], art)
+		}
+		if s := slug(art.Cate.Alias); s != "" {
+			if _, ok := cates[s]; !ok {
+				cates[s] = art.Cate
+			}
+			cateArts[s] = append(cateArts[s], art)
+		}
+	}
+	for s, tg := range tags {
+		for _, page := range g.paginate(tagArts[s], func(n int) string { return TagPath(s, n) }) {
+			page.Title, page.Tag = tg.Name, tg
+			if err := render(TemplateTag, page); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for s, cate := range cates {
+		for _, page := range g.paginate(cateArts[s], func(n int) string { return CategoryPath(s, n) }) {
+			page.Title, page.Category = cate.Name, cate
+			if err := render(TemplateCategory, page); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// 主题的静态文件
+	err := fs.WalkDir(theme.fsys, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		raw, err := fs.ReadFile(theme.fsys, p)
+		if err != nil {
+			return err
+		}
+		files["/"+p] = raw
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if g.Site.URL == "" {
+		return files, nil
+	}
+	// 站点地图与订阅需要完整的地址
+	for _, gen := range []func() (map[string][]byte, error){
+		func() (map[string][]byte, error) { return g.sitemap(pages) },
+		func() (map[string][]byte, error) { return g.feeds(arts) },
+	} {
+		more, err := gen()
+		if err != nil {
+			return nil, err
+		}
+		for name, raw := range more {
+			files[name] = raw
+		}
+	}
+	return files, nil
+}
+
+// paginate 将 arts 按 PageSize 分页，没有文章时也有一页
+func (g *Generator) paginate(arts []*collect.Article, url func(page int) string) []Page {
+	size := g.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	pages := (len(arts) + size - 1) / size
+	if pages == 0 {
+		pages = 1
+	}
+	r := make([]Page, 0, pages)
+	for n := 1; n <= pages; n++ {
+		page := Page{Site: g.Site, URL: url(n), Page: n, Pages: pages}
+		if start, end := (n-1)*size, n*size; end > len(arts) {
+			page.Articles = arts[start:]
+		} else {
+			page.Articles = arts[start:end]
+		}
+		if n > 1 {
+			page.PrevURL = url(n - 1)
+		}
+		if n < pages {
+			page.NextURL = url(n + 1)
+		}
+		r = append(r, page)
+	}
+	return r
+}
+
+// SortArticles 按 ArticlePath 去重后按发布时间从新到旧排序，时间相同时按路径排序
+func SortArticles(arts []*collect.Article) []*collect.Article {
+	index := make(map[string]int)
+	r := make([]*collect.Article, 0, len(arts))
+	for _, art := range arts {
+		p := ArticlePath(art)
+		if i, ok := index[p]; ok {
+			r[i] = art
+			continue
+		}
+		index[p] = len(r)
+		r = append(r, art)
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		if !r[i].PostTime.Equal(r[j].PostTime) {
+			return r[i].PostTime.After(r[j].PostTime)
+		}
+		return ArticlePath(r[i]) < ArticlePath(r[j])
+	})
+	return r
+}
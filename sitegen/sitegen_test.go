@@ -0,0 +1,286 @@
+package sitegen
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/panel/paneltest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// failingUploader 上传 n 个文件后失败
+type failingUploader struct {
+	collect.Uploader
+	n int
+}
+
+func (f *failingUploader) UploadWithTimeout(timeout time.Duration, name, serverPath string, fp *os.File, overwrite bool) error {
+	if f.n <= 0 {
+		return errors.New("upload failed")
+	}
+	f.n--
+	return f.Uploader.UploadWithTimeout(timeout, name, serverPath, fp, overwrite)
+}
+
+func testArticles() []*collect.Article {
+	day := func(d int) time.Time {
+		return time.Date(2022, 4, d, 10, 0, 0, 0, time.UTC)
+	}
+	return []*collect.Article{
+		{
+			Title:       "电商平台发布商家扶持新规",
+			Content:     `<p>正文</p><img src="/img/aa/a.png"/>`,
+			Href:        "https://www.nbtimes.net/yaowen/1001.html",
+			PostTime:    day(20),
+			Tag:         []collect.ArticleTag{{Name: "电商", Tag: "dianshang"}, {Name: "无链接"}},
+			Cate:        collect.Category{Name: "要闻", Alias: "yaowen"},
+			LocalImages: []string{"/img/aa/a.png"},
+			Images:      []collect.ImageRecord{{Path: "/img/aa/a.png", Status: collect.ImageOK}},
+			Cover:       "/img/aa/a.png",
+		},
+		{
+			Title:    "直播电商进入精细化运营阶段",
+			Content:  "<p>直播</p>",
+			Href:     "https://www.nbtimes.net/yaowen/1002.html",
+			Alias:    "live",
+			PostTime: day(21),
+			Tag:      []collect.ArticleTag{{Name: "电商", Tag: "dianshang"}},
+		},
+		{
+			Title:    "手机新品发布",
+			Content:  "<p>手机</p>",
+			Href:     "https://www.nbtimes.net/yaowen/1003.html",
+			PostTime: day(19),
+		},
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	return string(raw)
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	gen := &Generator{Site: Site{Title: "测试站", URL: "https://www.example.com/"}, Dir: dir, PageSize: 2}
+	arts := testArticles()
+	ctx := context.Background()
+	res, err := gen.Build(ctx, arts)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	first := ArticlePath(arts[0])
+	want := []string{
+		first,
+		ArticlePath(arts[2]),
+		"/article/live.html",
+		"/atom.xml",
+		"/category/yaowen/index.html",
+		"/index.html",
+		"/page/2.html",
+		"/rss.xml",
+		"/sitemap.xml",
+		"/tag/dianshang/index.html",
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(res.Written, want) || res.Unchanged != 0 {
+		t.Fatalf("written=%v unchanged=%d", res.Written, res.Unchanged)
+	}
+	page := readFile(t, filepath.Join(dir, first))
+	for _, s := range []string{
+		`<title>电商平台发布商家扶持新规 - 测试站</title>`,
+		`<link rel="canonical" href="https://www.example.com` + first + `">`,
+		`<p>正文</p><img src="/img/aa/a.png"/>`,
+		`<a href="/tag/dianshang/">电商</a> 无链接`,
+		`<a href="/category/yaowen/">要闻</a>`,
+	} {
+		if !strings.Contains(page, s) {
+			t.Errorf("article page does not contain %s\n%s", s, page)
+		}
+	}
+	index := readFile(t, filepath.Join(dir, "index.html"))
+	if !strings.Contains(index, `<a href="/article/live.html">`) || !strings.Contains(index, `<a href="/page/2.html">下一页</a>`) ||
+		strings.Index(index, "/article/live.html") > strings.Index(index, first) {
+		t.Errorf("index:\n%s", index)
+	}
+	if !strings.Contains(index, `<img src="/img/aa/a.png"`) {
+		t.Errorf("index has no cover:\n%s", index)
+	}
+	if tag := readFile(t, filepath.Join(dir, "tag", "dianshang", "index.html")); !strings.Contains(tag, "标签：电商") || strings.Contains(tag, "手机新品发布") {
+		t.Errorf("tag page:\n%s", tag)
+	}
+
+	// 没有变化时不重写，修改一篇文章只重写相关的页面
+	if res, err = gen.Build(ctx, arts); err != nil || len(res.Written) != 0 || res.Unchanged != len(want) {
+		t.Fatalf("written=%v unchanged=%d error:%v", res.Written, res.Unchanged, err)
+	}
+	arts[1].Title = "直播电商进入新阶段"
+	if res, err = gen.Build(ctx, arts); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if !reflect.DeepEqual(res.Written, []string{"/article/live.html", "/atom.xml", "/index.html", "/rss.xml", "/tag/dianshang/index.html"}) {
+		t.Fatalf("written=%v", res.Written)
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	root := collect.ImgRootPath
+	collect.ImgRootPath = t.TempDir()
+	defer func() {
+		collect.ImgRootPath = root
+	}()
+	if err := os.MkdirAll(collect.ImgRootPath+"/img/aa", 0755); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if err := os.WriteFile(collect.ImgRootPath+"/img/aa/a.png", []byte("png"), 0644); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	dir := t.TempDir()
+	gen := &Generator{Site: Site{Title: "测试站"}, Dir: dir}
+	arts := testArticles()
+	ctx := context.Background()
+	if _, err := gen.Build(ctx, arts); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	srv := paneltest.NewServer(t, "secret")
+	d := Deployer{Dir: dir, SiteRoot: "/www/wwwroot/example.com"}
+	images := []string{"/img/aa/a.png", "/img/aa/a.png"}
+
+	// 第 3 个文件上传失败时，前 2 个仍会记录
+	res, err := d.Deploy(ctx, &failingUploader{Uploader: srv.Client(), n: 2}, images)
+	if err == nil || res.Uploaded != 2 {
+		t.Fatalf("result=%+v error:%v", res, err)
+	}
+	if res, err = d.Deploy(ctx, srv.Client(), images); err != nil || res.Uploaded != 5 || res.Skipped != 2 {
+		t.Fatalf("result=%+v error:%v", res, err)
+	}
+	if files := srv.Files("/www/wwwroot/example.com"); len(files) != 7 {
+		t.Fatalf("files=%v", files)
+	}
+	if got, err := srv.ReadFile("/www/wwwroot/example.com/img/aa/a.png"); err != nil || string(got) != "png" {
+		t.Fatalf("image=%q error:%v", got, err)
+	}
+	if got, _ := srv.ReadFile("/www/wwwroot/example.com/index.html"); string(got) != readFile(t, filepath.Join(dir, "index.html")) {
+		t.Fatalf("index was not uploaded")
+	}
+	if res, err = d.Deploy(ctx, srv.Client(), images); err != nil || res.Uploaded != 0 || res.Skipped != 7 {
+		t.Fatalf("result=%+v error:%v", res, err)
+	}
+	arts[1].Title = "直播电商进入新阶段"
+	if _, err = gen.Build(ctx, arts); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	before := srv.Requests("upload")
+	if res, err = d.Deploy(ctx, srv.Client(), images); err != nil || res.Uploaded != 3 || res.Skipped != 4 {
+		t.Fatalf("result=%+v error:%v", res, err)
+	}
+	if n := srv.Requests("upload") - before; n != 3 {
+		t.Fatalf("%d upload requests", n)
+	}
+}
+
+func TestLoadTheme(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":       {Data: []byte(`{{template "list" .}}`)},
+		"tag.html":         {Data: []byte(`{{.Tag.Name}}`)},
+		"category.html":    {Data: []byte(`{{.Category.Name}}`)},
+		"layout.html":      {Data: []byte(`{{define "list"}}{{range .Articles}}{{.Title}};{{end}}{{end}}`)},
+		"static/style.css": {Data: []byte(`body{}`)},
+	}
+	if _, err := LoadTheme(fsys); !errors.Is(err, ErrInvalidTheme) {
+		t.Fatalf("error:%v", err)
+	}
+	fsys["article.html"] = &fstest.MapFile{Data: []byte(`{{content .Article}}`)}
+	theme, err := LoadTheme(fsys)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	gen := &Generator{Theme: theme}
+	files, err := gen.Render(testArticles())
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if string(files["/index.html"]) != "直播电商进入精细化运营阶段;电商平台发布商家扶持新规;手机新品发布;" {
+		t.Fatalf("index=%s", files["/index.html"])
+	}
+	if string(files["/article/live.html"]) != "<p>直播</p>" || string(files["/static/style.css"]) != "body{}" {
+		t.Fatalf("files=%v", files)
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	maxURLs := SitemapMaxURLs
+	defer func() {
+		SitemapMaxURLs = maxURLs
+	}()
+	gen := &Generator{Site: Site{Title: "测试站", URL: "https://www.example.com"}}
+	files, err := gen.Render(testArticles())
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	var set sitemapURLSet
+	if err = xml.Unmarshal(files[SitemapPath], &set); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	// 3 篇文章、首页、1 个标签、1 个分类
+	if len(set.URLs) != 6 || set.URLs[0].Loc != "https://www.example.com/" || set.URLs[0].LastMod != "2022-04-21T10:00:00Z" {
+		t.Fatalf("urls=%+v", set.URLs)
+	}
+	if !strings.Contains(string(files[SitemapPath]), `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`) {
+		t.Fatalf("sitemap=%s", files[SitemapPath])
+	}
+
+	var rss rssFeed
+	if err = xml.Unmarshal(files[RSSPath], &rss); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	items := rss.Channel.Items
+	if len(items) != 3 || items[0].Link != "https://www.example.com/article/live.html" || items[0].PubDate != "Thu, 21 Apr 2022 10:00:00 +0000" {
+		t.Fatalf("items=%+v", items)
+	}
+	if !strings.Contains(items[1].Description, `src="https://www.example.com/img/aa/a.png"`) || items[1].Category[0] != "电商" {
+		t.Fatalf("item=%+v", items[1])
+	}
+	var atom atomFeed
+	if err = xml.Unmarshal(files[AtomPath], &atom); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if atom.Updated != "2022-04-21T10:00:00Z" || len(atom.Entries) != 3 || atom.Entries[2].Published != "2022-04-19T10:00:00Z" || atom.Entries[2].Content.Type != "html" {
+		t.Fatalf("atom=%+v", atom)
+	}
+
+	// 超过 SitemapMaxURLs 时分片
+	SitemapMaxURLs = 4
+	if files, err = gen.Render(testArticles()); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	var index sitemapIndex
+	if err = xml.Unmarshal(files[SitemapPath], &index); err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if len(index.Sitemaps) != 2 || index.Sitemaps[1].Loc != "https://www.example.com/sitemap-2.xml" {
+		t.Fatalf("index=%+v", index)
+	}
+	set = sitemapURLSet{}
+	if err = xml.Unmarshal(files["/sitemap-2.xml"], &set); err != nil || len(set.URLs) != 2 {
+		t.Fatalf("urls=%+v error:%v", set.URLs, err)
+	}
+
+	// 没有站点地址时不生成
+	gen.Site.URL = ""
+	if files, _ = gen.Render(testArticles()); files[SitemapPath] != nil || files[RSSPath] != nil {
+		t.Fatalf("feeds generated without site url")
+	}
+}
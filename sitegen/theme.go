@@ -0,0 +1,95 @@
+package sitegen
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"html/template"
+	"io/fs"
+	"time"
+)
+
+var ErrInvalidTheme = errors.New("invalid theme")
+
+//go:embed theme
+var defaultTheme embed.FS
+
+// 主题必须包含的页面模板，以文件名为模板名
+const (
+	TemplateIndex    = "index.html"
+	TemplateTag      = "tag.html"
+	TemplateCategory = "category.html"
+	TemplateArticle  = "article.html"
+)
+
+// Theme 页面的模板，目录中的全部 *.html 一起解析，可以互相引用其中 define 的模板；
+// static 子目录中的文件原样复制到输出目录的 /static 下
+type Theme struct {
+	tmpl *template.Template
+	fsys fs.FS
+}
+
+// LoadTheme 从 fsys 读取主题，如：LoadTheme(os.DirFS("./theme"))
+// 模板中可以使用的函数：
+//
+//	articleURL 文章  文章页的路径
+//	tagURL 标签  标签页的路径，标签没有 Tag 时为空字符串
+//	categoryURL 分类  分类页的路径，分类没有 Alias 时为空字符串
+//	content 文章  不转义的正文
+//	cover 文章 宽度  封面宽度不小于该值的缩略图，没有封面时为空字符串
+//	date 格式 时间  格式化时间，零值时为空字符串
+func LoadTheme(fsys fs.FS) (*Theme, error) {
+	tmpl, err := template.New("").Funcs(funcs).ParseFS(fsys, "*.html")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTheme, err)
+	}
+	for _, name := range []string{TemplateIndex, TemplateTag, TemplateCategory, TemplateArticle} {
+		if tmpl.Lookup(name) == nil {
+			return nil, fmt.Errorf("%w: missing %s", ErrInvalidTheme, name)
+		}
+	}
+	return &Theme{tmpl: tmpl, fsys: fsys}, nil
+}
+
+// DefaultTheme 内置的主题
+func DefaultTheme() *Theme {
+	sub, err := fs.Sub(defaultTheme, "theme")
+	if err != nil {
+		panic(err)
+	}
+	theme, err := LoadTheme(sub)
+	if err != nil {
+		panic(err)
+	}
+	return theme
+}
+
+var funcs = template.FuncMap{
+	"articleURL":  ArticlePath,
+	"tagURL":      func(tag collect.ArticleTag) string { return TagPath(tag.Tag, 1) },
+	"categoryURL": func(cate collect.Category) string { return CategoryPath(cate.Alias, 1) },
+	"content": func(art *collect.Article) template.HTML {
+		return template.HTML(art.Content)
+	},
+	"cover": coverThumbnail,
+	"date": func(layout string, t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(layout)
+	},
+}
+
+// coverThumbnail 封面宽度不小于 width 的缩略图
+func coverThumbnail(art *collect.Article, width int) string {
+	if art.Cover == "" {
+		return ""
+	}
+	for _, rec := range art.Images {
+		if rec.Path == art.Cover {
+			return rec.Thumbnail(width)
+		}
+	}
+	return art.Cover
+}
@@ -1,12 +1,11 @@
 package nbtimes_net
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/cgghui/bt_site_cluster_collect/collect"
-	"github.com/cgghui/cgghui"
-	"io"
-	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +19,7 @@ func init() {
 	collect.RegisterStandard(Name, func() collect.Standard {
 		return &CollectGo{HomeURL: "https://www.nbtimes.net/"}
 	})
+	collect.RegisterRateLimit(Name, collect.RateLimit{Rate: 1, Burst: 2, MinDelay: 500 * time.Millisecond, MaxRetry: 2}, "www.nbtimes.net")
 }
 
 var Column = map[collect.Tag]string{
@@ -30,7 +30,8 @@ var Column = map[collect.Tag]string{
 }
 
 type CollectGo struct {
-	HomeURL string
+	HomeURL  string
+	Snapshot collect.SnapshotStore // 为 nil 时使用 collect.Snapshot
 }
 
 func (c CollectGo) GetTag() []collect.Tag {
@@ -42,25 +43,21 @@ func (c CollectGo) GetTag() []collect.Tag {
 }
 
 func (c CollectGo) ArticleList(tag collect.Tag, page int) ([]collect.Article, error) {
+	return c.ArticleListContext(context.Background(), tag, page)
+}
+
+func (c CollectGo) ArticleListContext(ctx context.Context, tag collect.Tag, page int) ([]collect.Article, error) {
 	if _, ok := Column[tag]; !ok {
 		return nil, collect.ErrUndefinedTag
 	}
 	target := c.HomeURL + Column[tag]
 	target = strings.Replace(target, "{page}", strconv.Itoa(page), 1)
-	req, err := http.NewRequest(http.MethodGet, target, nil)
+	body, _, err := collect.Fetch(ctx, target, true)
 	if err != nil {
 		return nil, err
 	}
-	collect.RequestStructure(req, true)
-	var resp *http.Response
-	if resp, err = collect.HttpClient.Do(req); err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
 	var doc *goquery.Document
-	if doc, err = goquery.NewDocumentFromReader(resp.Body); err != nil {
+	if doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body)); err != nil {
 		return nil, err
 	}
 	articles := make([]collect.Article, 0)
@@ -81,40 +78,24 @@ func (c CollectGo) HasSnapshot(art *collect.Article) bool {
 	if art.Href == "" {
 		return false
 	}
-	dir := cgghui.MD5(art.Href)
-	return collect.PathExists("./snapshot/" + Name + "/" + string(dir[0]) + "/" + dir + ".html")
+	return collect.HasSnapshot(c.Snapshot, Name, art.Href)
 }
 
 func (c CollectGo) ArticleDetail(art *collect.Article) error {
+	return c.ArticleDetailContext(context.Background(), art)
+}
+
+func (c CollectGo) ArticleDetailContext(ctx context.Context, art *collect.Article) error {
 	var err error
 	if art.Href == "" {
 		return collect.ErrUndefinedArticleHref
 	}
-	var cache *os.File
-	dir := cgghui.MD5(art.Href)
-	snapshotPath := "./snapshot/" + Name + "/" + string(dir[0]) + "/"
-	_ = os.MkdirAll(snapshotPath, 0666)
-	snapshotPath += dir + ".html"
-	if cache, err = os.Open(snapshotPath); err != nil {
-		var req *http.Request
-		if req, err = http.NewRequest(http.MethodGet, art.Href, nil); err != nil {
-			return err
-		}
-		collect.RequestStructure(req, true)
-		var resp *http.Response
-		if resp, err = collect.HttpClient.Do(req); err != nil {
-			return err
-		}
-		defer func() {
-			_ = resp.Body.Close()
-		}()
-		if cache, err = os.Create(snapshotPath); err == nil {
-			_, _ = io.Copy(cache, resp.Body)
-		}
-		_, _ = cache.Seek(0, io.SeekStart)
+	var body []byte
+	if body, err = collect.FetchSnapshot(ctx, c.Snapshot, Name, art.Href, true); err != nil {
+		return err
 	}
 	var doc *goquery.Document
-	if doc, err = goquery.NewDocumentFromReader(cache); err != nil {
+	if doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body)); err != nil {
 		return err
 	}
 	art.Title = doc.Find(`meta[property="og:title"]`).AttrOr("content", "")
@@ -128,19 +109,21 @@ func (c CollectGo) ArticleDetail(art *collect.Article) error {
 	if art.LocalImages == nil {
 		art.LocalImages = make([]string, 0)
 	}
+	if art.Images == nil {
+		art.Images = make([]collect.ImageRecord, 0)
+	}
 	word := doc.Find(".entry-content")
 	//
 	word.Find("div").Last().Remove()
 	word.Find("p").Last().Remove()
 	// 处理图片
-	word.Find(".pgc-img").Each(func(_ int, div *goquery.Selection) {
-		img := div.Find("img")
-		src := img.AttrOr("src", "")
-		if src == "" {
-			return
-		}
-		var imgPath string
-		if imgPath, err = collect.DownloadImage(src); err != nil {
+	src := func(img *goquery.Selection) string {
+		return img.AttrOr("src", "")
+	}
+	var ie *collect.ImagesError
+	err = collect.DownloadImages(ctx, art, word.Find(".pgc-img img"), src, func(img *goquery.Selection, rec collect.ImageRecord) {
+		div := img.Closest(".pgc-img")
+		if rec.Status != collect.ImageOK {
 			div.Remove()
 			return
 		}
@@ -153,12 +136,15 @@ func (c CollectGo) ArticleDetail(art *collect.Article) error {
 		}
 		img.RemoveAttr("data-ic")
 		img.RemoveAttr("data-ic-uri")
-		img.SetAttr("src", imgPath)
 		imgHTML, _ := div.Html()
 		div.BeforeHtml(imgHTML)
 		div.Remove()
-		art.LocalImages = append(art.LocalImages, imgPath)
 	})
+	// 下载失败的图片已记录在 art.Images 中，不影响文章的采集
+	if err != nil && !errors.As(err, &ie) {
+		return err
+	}
+	collect.SelectCover(ctx, art, doc.Find(`meta[property="og:image"]`).AttrOr("content", ""))
 	// 处理<a>
 	if art.Tag == nil {
 		art.Tag = make([]collect.ArticleTag, 0)
@@ -3,10 +3,39 @@ package techsir_com
 import (
 	"fmt"
 	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/collect/collecttest"
 	"testing"
 )
 
+var routes = map[string]string{
+	"https://www.techsir.com/ebiz/index.html":       "testdata/list.html",
+	"https://www.techsir.com/ebiz/202204/2001.html": "testdata/detail_2001.html",
+	"https://www.techsir.com/uploads/2022/04/b.png": "testdata/img.png",
+}
+
+func TestArticleReplay(t *testing.T) {
+	collecttest.Install(t, routes)
+	obj := collect.GetStandard(Name)
+	list, err := obj.ArticleList(collect.TagCommerce, 1)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("article list == %d", len(list))
+	}
+	for i := range list {
+		if err = obj.ArticleDetail(&list[i]); err != nil {
+			t.Fatalf("%s error:%v", list[i].Href, err)
+		}
+		if !obj.HasSnapshot(&list[i]) {
+			t.Fatalf("%s snapshot not saved", list[i].Href)
+		}
+	}
+	collecttest.AssertGolden(t, "testdata/article.golden.json", list)
+}
+
 func TestTechsir(t *testing.T) {
+	collecttest.Live(t)
 	obj := collect.GetStandard(Name)
 	list, err := obj.ArticleList(collect.TagCommerce, 1)
 	if err != nil {
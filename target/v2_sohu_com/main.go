@@ -2,16 +2,14 @@ package v2_sohu_com
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/cgghui/bt_site_cluster_collect/collect"
-	"github.com/cgghui/cgghui"
 	"github.com/mozillazg/go-pinyin"
-	"io"
-	"net/http"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -26,6 +24,7 @@ func init() {
 	collect.RegisterStandard(Name, func() collect.Standard {
 		return &CollectGo{HomeURL: "https://v2.sohu.com/"}
 	})
+	collect.RegisterRateLimit(Name, collect.RateLimit{Rate: 2, Burst: 4, MinDelay: 200 * time.Millisecond, MaxRetry: 2}, "v2.sohu.com", "www.sohu.com")
 }
 
 var pyArg = pinyin.NewArgs()
@@ -44,7 +43,8 @@ var Column = map[collect.Tag]string{
 }
 
 type CollectGo struct {
-	HomeURL string
+	HomeURL  string
+	Snapshot collect.SnapshotStore // 为 nil 时使用 collect.Snapshot
 }
 
 func (c CollectGo) GetTag() []collect.Tag {
@@ -71,25 +71,21 @@ type ArticleTag struct {
 }
 
 func (c CollectGo) ArticleList(tag collect.Tag, page int) ([]collect.Article, error) {
+	return c.ArticleListContext(context.Background(), tag, page)
+}
+
+func (c CollectGo) ArticleListContext(ctx context.Context, tag collect.Tag, page int) ([]collect.Article, error) {
 	if _, ok := Column[tag]; !ok {
 		return nil, collect.ErrUndefinedTag
 	}
 	target := c.HomeURL + Column[tag]
 	target = strings.Replace(target, "{page}", strconv.Itoa(page), 1)
-	req, err := http.NewRequest(http.MethodGet, target, nil)
+	body, _, err := collect.Fetch(ctx, target, true)
 	if err != nil {
 		return nil, err
 	}
-	collect.RequestStructure(req, true)
-	var resp *http.Response
-	if resp, err = collect.HttpClient.Do(req); err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
 	var ret []Article
-	if err = json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+	if err = json.Unmarshal(body, &ret); err != nil {
 		return nil, err
 	}
 	articles := make([]collect.Article, 0, len(ret))
@@ -124,56 +120,46 @@ func (c CollectGo) HasSnapshot(art *collect.Article) bool {
 	if art.Href == "" {
 		return false
 	}
-	dir := cgghui.MD5("https://www.sohu.com/a/" + art.Href)
-	return collect.PathExists("./snapshot/" + Name + "/" + string(dir[0]) + "/" + dir + ".html")
+	return collect.HasSnapshot(c.Snapshot, Name, "https://www.sohu.com/a/"+art.Href)
 }
 
 func (c CollectGo) ArticleDetail(art *collect.Article) error {
+	return c.ArticleDetailContext(context.Background(), art)
+}
+
+func (c CollectGo) ArticleDetailContext(ctx context.Context, art *collect.Article) error {
 	var err error
 	if art.Href == "" {
 		return collect.ErrUndefinedArticleHref
 	}
 	target := "https://www.sohu.com/a/" + art.Href
-	var cache *os.File
-	dir := cgghui.MD5(target)
-	snapshotPath := "./snapshot/" + Name + "/" + string(dir[0]) + "/"
-	_ = os.MkdirAll(snapshotPath, 0666)
-	snapshotPath += dir + ".html"
-	if cache, err = os.Open(snapshotPath); err != nil {
-		var req *http.Request
-		if req, err = http.NewRequest(http.MethodGet, target, nil); err != nil {
-			return err
-		}
-		collect.RequestStructure(req, true)
-		var resp *http.Response
-		if resp, err = collect.HttpClient.Do(req); err != nil {
-			return err
-		}
-		defer func() {
-			_ = resp.Body.Close()
-		}()
-		if cache, err = os.Create(snapshotPath); err == nil {
-			_, _ = io.Copy(cache, resp.Body)
-		}
-		_, _ = cache.Seek(0, io.SeekStart)
+	var body []byte
+	if body, err = collect.FetchSnapshot(ctx, c.Snapshot, Name, target, true); err != nil {
+		return err
 	}
 	var doc *goquery.Document
-	if doc, err = goquery.NewDocumentFromReader(cache); err != nil {
+	if doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body)); err != nil {
 		return err
 	}
 	if art.LocalImages == nil {
 		art.LocalImages = make([]string, 0)
 	}
+	if art.Images == nil {
+		art.Images = make([]collect.ImageRecord, 0)
+	}
 	word := doc.Find("#mp-editor")
 	word.Find(".backsohu").Parent().Remove()
 	// 处理图片
-	word.Find("img").Each(func(_ int, img *goquery.Selection) {
+	src := func(img *goquery.Selection) string {
 		dataSrc := img.AttrOr("data-src", "")
 		if dataSrc == "" {
-			return
+			return ""
 		}
-		var imgPath string
-		if imgPath, err = collect.DownloadImage(string(AesDecryptECB(dataSrc))); err != nil {
+		return string(AesDecryptECB(dataSrc))
+	}
+	var ie *collect.ImagesError
+	err = collect.DownloadImages(ctx, art, word.Find("img"), src, func(img *goquery.Selection, rec collect.ImageRecord) {
+		if rec.Status != collect.ImageOK {
 			img.Remove()
 			return
 		}
@@ -185,9 +171,12 @@ func (c CollectGo) ArticleDetail(art *collect.Article) error {
 			}
 		}
 		img.RemoveAttr("data-src")
-		img.SetAttr("src", imgPath)
-		art.LocalImages = append(art.LocalImages, imgPath)
 	})
+	// 下载失败的图片已记录在 art.Images 中，不影响文章的采集
+	if err != nil && !errors.As(err, &ie) {
+		return err
+	}
+	collect.SelectCover(ctx, art, doc.Find(`meta[property="og:image"]`).AttrOr("content", ""))
 	// 处理<a>
 	if art.Tag == nil {
 		art.Tag = make([]collect.ArticleTag, 0)
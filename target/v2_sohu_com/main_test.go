@@ -3,10 +3,39 @@ package v2_sohu_com
 import (
 	"fmt"
 	"github.com/cgghui/bt_site_cluster_collect/collect"
+	"github.com/cgghui/bt_site_cluster_collect/collect/collecttest"
 	"testing"
 )
 
+var routes = map[string]string{
+	"https://v2.sohu.com/public-api/feed?scene=TAG&sceneId=65777&page=1&size=20": "testdata/list.json",
+	"https://www.sohu.com/a/532000001_121000001":                                 "testdata/detail_532000001.html",
+	"http://p3.itc.cn/img/a012.png":                                              "testdata/img.png",
+}
+
+func TestArticleReplay(t *testing.T) {
+	collecttest.Install(t, routes)
+	obj := collect.GetStandard(Name)
+	list, err := obj.ArticleList(collect.TagCommerce, 1)
+	if err != nil {
+		t.Fatalf("error:%v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("article list == %d", len(list))
+	}
+	for i := range list {
+		if err = obj.ArticleDetail(&list[i]); err != nil {
+			t.Fatalf("%s error:%v", list[i].Href, err)
+		}
+		if !obj.HasSnapshot(&list[i]) {
+			t.Fatalf("%s snapshot not saved", list[i].Href)
+		}
+	}
+	collecttest.AssertGolden(t, "testdata/article.golden.json", list)
+}
+
 func TestTechsir(t *testing.T) {
+	collecttest.Live(t)
 	obj := collect.GetStandard(Name)
 	list, err := obj.ArticleList(collect.TagFashion, 1)
 	if err != nil {